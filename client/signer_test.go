@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKnownAnswers(t *testing.T) {
+	// Changing the derivation would invalidate every stored signing key
+	if got := hex.EncodeToString(DeriveSigningKey("s3cret")); got != "ff5a8b8df9a5c44a51e2dca1ab1c4a5c7a646db3ab315b53f385deb19b7bc2bb" {
+		t.Errorf("DeriveSigningKey = %s", got)
+	}
+
+	// RFC 4231, test case 2
+	if got := Signature([]byte("Jefe"), "what do ya want for nothing?"); got != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("Signature = %s", got)
+	}
+
+	if got := HashBody(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("HashBody(nil) = %s", got)
+	}
+
+	want := "HC-HMAC-SHA256\n20240102T030405Z\nba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := StringToSign("20240102T030405Z", "abc"); got != want {
+		t.Errorf("StringToSign = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalRequest(t *testing.T) {
+	headers := map[string]string{
+		"content-type": "  text/plain   charset=utf-8 ",
+		"host":         "storage.local",
+		"x-hc-date":    "20240102T030405Z",
+	}
+	got := CanonicalRequest("put", "", "sp=x+y&b=2&a=1&a=0", headers, []string{"content-type", "host", "x-hc-date"}, "abc123")
+
+	want := "PUT\n" +
+		"/\n" +
+		"a=1&a=0&b=2&sp=x%20y\n" +
+		"content-type:text/plain charset=utf-8\n" +
+		"host:storage.local\n" +
+		"x-hc-date:20240102T030405Z\n" +
+		"\n" +
+		"content-type;host;x-hc-date\n" +
+		"abc123"
+	if got != want {
+		t.Fatalf("canonical request:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signer := NewSigner("key-1", "s3cret")
+	signer.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)) }
+
+	req, err := http.NewRequest(http.MethodPut, "https://storage.local/api/v1/storage/files/abc?b=2&a=1", strings.NewReader("new content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Bucket-Name", "records")
+	req.Header.Set("Accept", "application/json")
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := req.Header.Get(HeaderDate); got != "20240102T020405Z" {
+		t.Errorf("date = %s, want UTC", got)
+	}
+	if got := req.Header.Get(HeaderContentSHA256); got != HashBody([]byte("new content")) {
+		t.Errorf("body hash = %s", got)
+	}
+	if len(req.Header.Get(HeaderNonce)) != 32 {
+		t.Errorf("nonce = %q, want 16 random bytes in hex", req.Header.Get(HeaderNonce))
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != "new content" {
+		t.Errorf("body after signing = %q", body)
+	}
+
+	authorization := req.Header.Get("Authorization")
+	prefix := "HC-HMAC-SHA256 Credential=key-1, SignedHeaders=content-type;host;x-bucket-name;x-hc-content-sha256;x-hc-date;x-hc-nonce, Signature="
+	if !strings.HasPrefix(authorization, prefix) {
+		t.Fatalf("Authorization = %s", authorization)
+	}
+
+	// The signature is recomputed from the canonical request
+	headers := map[string]string{
+		"content-type":        "text/plain",
+		"host":                "storage.local",
+		"x-bucket-name":       "records",
+		"x-hc-content-sha256": req.Header.Get(HeaderContentSHA256),
+		"x-hc-date":           req.Header.Get(HeaderDate),
+		"x-hc-nonce":          req.Header.Get(HeaderNonce),
+	}
+	signed := []string{"content-type", "host", "x-bucket-name", "x-hc-content-sha256", "x-hc-date", "x-hc-nonce"}
+	canonical := CanonicalRequest("PUT", "/api/v1/storage/files/abc", "a=1&b=2", headers, signed, HashBody([]byte("new content")))
+	want := Signature(DeriveSigningKey("s3cret"), StringToSign("20240102T020405Z", canonical))
+	if got := strings.TrimPrefix(authorization, prefix); got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+
+	// Every signature carries a fresh nonce
+	again, _ := http.NewRequest(http.MethodPut, "https://storage.local/api/v1/storage/files/abc?b=2&a=1", strings.NewReader("new content"))
+	if err := signer.Sign(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.Header.Get(HeaderNonce) == req.Header.Get(HeaderNonce) || again.Header.Get("Authorization") == authorization {
+		t.Fatal("two signatures share a nonce")
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
 	"os"
+	"time"
 
 	"github.com/JAreyes98/healthconnect-storage-service/config"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/api/routes"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/auth"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/ratelimit"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -24,14 +29,91 @@ func main() {
 	}
 	defer auditSvc.Close() // Ahora sí existe
 
+	// Reconstruye los contadores de uso de las cuotas
+	if err := service.NewUsageService(db).Recalculate(); err != nil {
+		log.Printf("Warning: could not recalculate storage usage: %v", err)
+	}
+
+	// Purga de la papelera en segundo plano
+	purgeInterval, err := time.ParseDuration(os.Getenv("TRASH_PURGE_INTERVAL"))
+	if err != nil || purgeInterval <= 0 {
+		purgeInterval = time.Hour
+	}
+	go service.NewTrashService(db, auditSvc).Run(context.Background(), purgeInterval)
+
+	// Borrado de archivos temporales expirados (TTL)
+	expiryInterval, err := time.ParseDuration(os.Getenv("EXPIRY_REAPER_INTERVAL"))
+	if err != nil || expiryInterval <= 0 {
+		expiryInterval = 5 * time.Minute
+	}
+	go service.NewExpiryService(db, auditSvc).Run(context.Background(), expiryInterval)
+
+	// Reglas de ciclo de vida (mover a buckets más baratos o borrar)
+	lifecycleInterval, err := time.ParseDuration(os.Getenv("LIFECYCLE_INTERVAL"))
+	if err != nil || lifecycleInterval <= 0 {
+		lifecycleInterval = time.Hour
+	}
+	go service.NewLifecycleService(db, auditSvc).Run(context.Background(), lifecycleInterval)
+
+	// Autenticación del API de administración (JWT del proveedor de identidad)
+	jwksRefresh, err := time.ParseDuration(os.Getenv("ADMIN_JWKS_REFRESH"))
+	if err != nil || jwksRefresh <= 0 {
+		jwksRefresh = 10 * time.Minute
+	}
+	adminKeys, err := auth.NewKeySet(os.Getenv("ADMIN_JWKS_FILE"), os.Getenv("ADMIN_JWKS_URL"), jwksRefresh)
+	if err != nil {
+		log.Fatalf("Critical: Could not load admin JWKS: %v", err)
+	}
+	// Sin emisor y audiencia se aceptarían tokens emitidos para otros clientes
+	adminVerifier := &auth.Verifier{
+		Keys:       adminKeys,
+		Issuer:     os.Getenv("ADMIN_JWT_ISSUER"),
+		Audience:   os.Getenv("ADMIN_JWT_AUDIENCE"),
+		RolesClaim: os.Getenv("ADMIN_JWT_ROLES_CLAIM"),
+	}
+	if adminVerifier.Issuer == "" || adminVerifier.Audience == "" {
+		log.Fatal("Critical: ADMIN_JWT_ISSUER and ADMIN_JWT_AUDIENCE must be set")
+	}
+
+	// Los enlaces compartidos solo usan la URL pública configurada
+	if os.Getenv("SHARE_BASE_URL") == "" {
+		log.Println("Warning: SHARE_BASE_URL is not set, share links are disabled")
+	}
+
 	app := fiber.New()
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: origins,
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-Key, X-API-Secret",
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+		AllowOrigins:  origins,
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-API-Key, X-API-Secret, X-HC-Date, X-HC-Nonce, X-HC-Content-SHA256",
+		ExposeHeaders: "Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy",
+		AllowMethods:  "GET, POST, PUT, DELETE, OPTIONS",
 	}))
 	// Configurar rutas, etc.
-	routes.SetupRoutes(app, db, auditSvc)
+	// Límites por app en memoria; ratelimit.RedisBackend los comparte entre instancias
+	routes.SetupRoutes(app, db, auditSvc, adminVerifier, ratelimit.NewMemoryBackend())
 
-	log.Fatal(app.Listen(":8082"))
+	// TLS opcional; con TLS_CLIENT_CA_FILE se verifican certificados de cliente (mTLS)
+	if os.Getenv("TLS_CERT_FILE") == "" {
+		log.Fatal(app.Listen(":8082"))
+	}
+
+	tlsRefresh, err := time.ParseDuration(os.Getenv("TLS_RELOAD_INTERVAL"))
+	if err != nil || tlsRefresh <= 0 {
+		tlsRefresh = time.Minute
+	}
+	tlsFiles, err := auth.NewTLSFiles(os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"), os.Getenv("TLS_CLIENT_CA_FILE"), tlsRefresh)
+	if err != nil {
+		log.Fatalf("Critical: Could not load TLS files: %v", err)
+	}
+
+	// Por defecto el certificado de cliente es opcional: las apps con API key siguen funcionando
+	clientAuth := tls.VerifyClientCertIfGiven
+	if os.Getenv("TLS_CLIENT_CERT_REQUIRED") == "true" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	ln, err := tls.Listen("tcp", ":8082", tlsFiles.Config(clientAuth))
+	if err != nil {
+		log.Fatalf("Critical: Could not listen: %v", err)
+	}
+	log.Fatal(app.Listener(ln))
 }
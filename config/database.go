@@ -4,8 +4,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/JAreyes98/healthconnect-storage-service/client"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -45,12 +51,198 @@ func InitDB() *gorm.DB {
 	}
 
 	// 5. Migraciones
-	db.AutoMigrate(
+	if err := Migrate(db); err != nil {
+		log.Printf("Warning: auto-migration failed: %v", err)
+	}
+
+	migrateLocalPaths(db)
+	migrateCredentials(db)
+
+	return db
+}
+
+// Migrate creates or updates the tables of every model.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&model.App{},
 		&model.Bucket{},
 		&model.FileMetadata{},
 		&model.ReplicationRule{},
+		&model.Blob{},
+		&model.FileVersion{},
+		&model.LifecycleRule{},
+		&model.UsageStat{},
+		&model.ApiCredential{},
+		&model.ShareLink{},
+		&model.PendingUpload{},
+		&model.ClientCertificate{},
+		&model.DataMigration{},
 	)
+}
 
-	return db
+// migrateCredentials moves the single key and secret of older apps into
+// api_credentials, hashing plaintext secrets on the way, and then drops the
+// old columns from apps.
+func migrateCredentials(db *gorm.DB) {
+	m := db.Migrator()
+	if !m.HasColumn("apps", "api_key") {
+		return
+	}
+
+	columns := "id, api_key"
+	hasPlain := m.HasColumn("apps", "api_secret")
+	if hasPlain {
+		columns += ", api_secret"
+	}
+	if m.HasColumn("apps", "secret_hash") {
+		columns += ", secret_hash"
+	}
+
+	var rows []struct {
+		ID         uuid.UUID
+		ApiKey     string
+		ApiSecret  string
+		SecretHash string
+	}
+	db.Table("apps").Select(columns).Scan(&rows)
+
+	for _, row := range rows {
+		var count int64
+		db.Model(&model.ApiCredential{}).Where("api_key = ?", row.ApiKey).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		hash := row.SecretHash
+		if hash == "" && hasPlain {
+			var err error
+			if hash, err = crypto.HashSecret(row.ApiSecret); err != nil {
+				log.Fatalf("Error crítico: no se pudo cifrar el secreto de la app %s: %v", row.ID, err)
+			}
+		}
+
+		credential := model.ApiCredential{
+			ID:         uuid.New(),
+			AppID:      row.ID,
+			ApiKey:     row.ApiKey,
+			SecretHash: hash,
+			Label:      "migrated",
+		}
+		// Signed requests need the key derived from the plaintext secret. Apps
+		// that only kept a hash must rotate their credential to sign requests.
+		if row.ApiSecret != "" {
+			if sealed, err := crypto.Encrypt(client.DeriveSigningKey(row.ApiSecret)); err == nil {
+				credential.SigningKey = sealed
+			} else {
+				log.Printf("Warning: credential of app %s migrated without a request-signing key: %v", row.ID, err)
+			}
+		}
+		if err := db.Create(&credential).Error; err != nil {
+			// Keep the old columns so the next start can retry
+			log.Printf("Warning: could not migrate credential of app %s: %v", row.ID, err)
+			return
+		}
+	}
+
+	for _, column := range []string{"api_secret", "secret_hash", "api_key"} {
+		if m.HasColumn("apps", column) {
+			if err := m.DropColumn(&model.App{}, column); err != nil {
+				log.Printf("Warning: could not drop apps.%s: %v", column, err)
+			}
+		}
+	}
+}
+
+// runOnce runs a one-off data migration unless it is already marked as
+// applied. A failed migration is not marked, so the next start retries it.
+func runOnce(db *gorm.DB, name string, migrate func() error) {
+	var applied int64
+	if err := db.Model(&model.DataMigration{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+		log.Printf("Warning: could not check data migration %s: %v", name, err)
+		return
+	}
+	if applied > 0 {
+		return
+	}
+
+	if err := migrate(); err != nil {
+		log.Printf("Warning: data migration %s failed, retrying on next start: %v", name, err)
+		return
+	}
+	if err := db.Create(&model.DataMigration{Name: name, AppliedAt: time.Now()}).Error; err != nil {
+		log.Printf("Warning: could not mark data migration %s as applied: %v", name, err)
+	}
+}
+
+// localPathBatchSize is how many rows migrateLocalPaths loads at a time.
+const localPathBatchSize = 500
+
+// migrateLocalPaths rewrites absolute physical paths of LOCAL buckets as paths
+// relative to the bucket directory, so the directory can be moved. Trashed
+// files, earlier versions and dedup blobs are rewritten too.
+func migrateLocalPaths(db *gorm.DB) {
+	runOnce(db, "local_relative_paths", func() error {
+		var buckets []model.Bucket
+		if err := db.Where("provider_type = ?", "LOCAL").Find(&buckets).Error; err != nil {
+			return err
+		}
+
+		for _, bucket := range buckets {
+			scopes := map[string]*gorm.DB{
+				"file_metadata": db.Unscoped().Table("file_metadata").
+					Where("bucket_id = ?", bucket.ID),
+				"file_versions": db.Unscoped().Table("file_versions").
+					Select("file_versions.id, file_versions.physical_path").
+					Joins("JOIN file_metadata ON file_metadata.id = file_versions.file_id").
+					Where("file_metadata.bucket_id = ?", bucket.ID),
+				"blobs": db.Table("blobs").Where("bucket_id = ?", bucket.ID),
+			}
+			for table, scope := range scopes {
+				if err := relativizeLocalPaths(db, scope, table, bucket); err != nil {
+					return fmt.Errorf("bucket %s, %s: %w", bucket.Name, table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// relativizeLocalPaths rewrites the absolute physical_path of the rows of
+// table selected by scope, in batches.
+func relativizeLocalPaths(db, scope *gorm.DB, table string, bucket model.Bucket) error {
+	var rows []struct {
+		ID           uuid.UUID
+		PhysicalPath string
+	}
+	rewritten, outside := 0, 0
+
+	err := scope.FindInBatches(&rows, localPathBatchSize, func(_ *gorm.DB, _ int) error {
+		for _, row := range rows {
+			if !filepath.IsAbs(row.PhysicalPath) {
+				continue
+			}
+			rel, ok := storage.RelativeLocalPath(row.PhysicalPath, bucket.Config)
+			if !ok {
+				outside++
+				continue
+			}
+			// Table updates leave updated_at alone, which lifecycle rules rely on
+			if err := db.Table(table).Where("id = ?", row.ID).Update("physical_path", rel).Error; err != nil {
+				return err
+			}
+			rewritten++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if rewritten > 0 {
+		log.Printf("Migrated %d LOCAL paths in %s of bucket %s", rewritten, table, bucket.Name)
+	}
+	if outside > 0 {
+		log.Printf("Warning: %d paths in %s of bucket %s are outside its directory and were left as they are", outside, table, bucket.Name)
+	}
+	return nil
 }
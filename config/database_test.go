@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/client"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateLocalPaths(t *testing.T) {
+	db := newTestDB(t)
+	base := t.TempDir()
+
+	bucket := model.Bucket{ID: uuid.New(), AppID: uuid.New(), Name: "records", ProviderType: "LOCAL", Config: `{"path":"` + base + `"}`}
+	db.Create(&bucket)
+
+	file := func(path string) model.FileMetadata {
+		f := model.FileMetadata{ID: uuid.New(), AppID: bucket.AppID, BucketID: bucket.ID, OriginalName: "f.txt", PhysicalPath: path, Version: 2}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	live := file(filepath.Join(base, "ab", "live.txt"))
+	trashed := file(filepath.Join(base, "cd", "trashed.txt"))
+	db.Delete(&trashed)
+	relative := file("ef/relative.txt")
+	outside := file("/elsewhere/outside.txt")
+
+	version := model.FileVersion{ID: uuid.New(), FileID: trashed.ID, Version: 1, PhysicalPath: filepath.Join(base, "cd", "trashed.v1.txt")}
+	db.Create(&version)
+	blob := model.Blob{ID: uuid.New(), BucketID: bucket.ID, Hash: "h", PhysicalPath: filepath.Join(base, "blobs", "h")}
+	db.Create(&blob)
+
+	migrateLocalPaths(db)
+
+	paths := map[uuid.UUID]string{}
+	var files []model.FileMetadata
+	db.Unscoped().Find(&files)
+	for _, f := range files {
+		paths[f.ID] = f.PhysicalPath
+	}
+	db.First(&version, "id = ?", version.ID)
+	db.First(&blob, "id = ?", blob.ID)
+
+	for name, c := range map[string]struct{ got, want string }{
+		"live file":    {paths[live.ID], "ab/live.txt"},
+		"trashed file": {paths[trashed.ID], "cd/trashed.txt"},
+		"relative":     {paths[relative.ID], "ef/relative.txt"},
+		"outside":      {paths[outside.ID], "/elsewhere/outside.txt"},
+		"version":      {version.PhysicalPath, "cd/trashed.v1.txt"},
+		"blob":         {blob.PhysicalPath, "blobs/h"},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s: physical path = %q, want %q", name, c.got, c.want)
+		}
+	}
+
+	// The migration is marked as applied and does not scan again
+	later := file(filepath.Join(base, "gh", "later.txt"))
+	migrateLocalPaths(db)
+	db.First(&later, "id = ?", later.ID)
+	if !filepath.IsAbs(later.PhysicalPath) {
+		t.Fatalf("migration ran again and rewrote %q", later.PhysicalPath)
+	}
+}
+
+func TestRunOnceRetriesFailedMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	runs := 0
+	fail := func() error {
+		runs++
+		if runs == 1 {
+			return gorm.ErrInvalidTransaction
+		}
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		runOnce(db, "example", fail)
+	}
+	if runs != 2 {
+		t.Fatalf("migration ran %d times, want a failed run and a successful retry", runs)
+	}
+
+	var marker model.DataMigration
+	if err := db.First(&marker, "name = ?", "example").Error; err != nil || marker.AppliedAt.After(time.Now()) {
+		t.Fatalf("marker = %+v, %v", marker, err)
+	}
+}
+
+func TestMigrateCredentialsKeepsSigning(t *testing.T) {
+	t.Setenv("STORAGE_CIPHER_KEY", "0123456789abcdef0123456789abcdef")
+	db := newTestDB(t)
+
+	plain := model.App{ID: uuid.New(), AppName: "plain"}
+	hashed := model.App{ID: uuid.New(), AppName: "hashed"}
+	db.Create(&plain)
+	db.Create(&hashed)
+
+	// The columns of the single-credential schema
+	for _, column := range []string{"api_key", "api_secret", "secret_hash"} {
+		if err := db.Exec("ALTER TABLE apps ADD COLUMN `" + column + "` text").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Exec("UPDATE apps SET api_key = ?, api_secret = ? WHERE id = ?", "key-plain", "secret-plain", plain.ID)
+	db.Exec("UPDATE apps SET api_key = ?, secret_hash = ? WHERE id = ?", "key-hashed", "argon2id$legacy", hashed.ID)
+
+	migrateCredentials(db)
+
+	var migrated model.ApiCredential
+	if err := db.First(&migrated, "api_key = ?", "key-plain").Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypto.Decrypt(migrated.SigningKey)
+	if err != nil || !bytes.Equal(key, client.DeriveSigningKey("secret-plain")) {
+		t.Fatalf("migrated signing key = %x, %v", key, err)
+	}
+	if !crypto.VerifySecret("secret-plain", migrated.SecretHash) {
+		t.Fatal("migrated secret hash does not verify")
+	}
+
+	// Without the plaintext no signing key can be derived
+	var hashOnly model.ApiCredential
+	if err := db.First(&hashOnly, "api_key = ?", "key-hashed").Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(hashOnly.SigningKey) != 0 || hashOnly.SecretHash != "argon2id$legacy" {
+		t.Fatalf("hash-only credential = %+v", hashOnly)
+	}
+
+	if db.Migrator().HasColumn("apps", "api_secret") {
+		t.Fatal("plaintext secrets were kept after the migration")
+	}
+}
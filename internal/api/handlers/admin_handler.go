@@ -1,10 +1,9 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"fmt"
 
+	"github.com/JAreyes98/healthconnect-storage-service/internal/compress"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/gofiber/fiber/v2"
@@ -13,14 +12,16 @@ import (
 )
 
 type AdminHandler struct {
-	DB    *gorm.DB
-	Audit *service.AuditService
+	DB          *gorm.DB
+	Audit       *service.AuditService
+	Credentials *service.CredentialService
 }
 
 func NewAdminHandler(db *gorm.DB, audit *service.AuditService) *AdminHandler {
 	return &AdminHandler{
-		DB:    db,
-		Audit: audit,
+		DB:          db,
+		Audit:       audit,
+		Credentials: service.NewCredentialService(db),
 	}
 }
 
@@ -34,12 +35,30 @@ func (h *AdminHandler) CreateApp(c *fiber.Ctx) error {
 			"sent_data": string(c.Body()),
 		})
 	}
+	if err := validCIDRs(app.AllowedCIDRs); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 	app.ID = uuid.New()
-	app.ApiKey = generateToken(16)
-	app.ApiSecret = generateToken(32)
-
-	h.DB.Create(&app)
+	app.UsedBytes = 0
+	app.FileCount = 0
+
+	// Only the hash is stored; this response is the one time the secret is shown
+	var credential model.ApiCredential
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&app).Error; err != nil {
+			return err
+		}
+		var err error
+		credential, err = h.Credentials.Issue(tx, model.ApiCredential{AppID: app.ID, Label: "initial"})
+		return err
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create app: " + err.Error()})
+	}
 	h.Audit.LogEvent("ADMIN_APP_CREATE", fmt.Sprintf("New App created: %s (ID: %s)", app.AppName, app.ID), "INFO")
+
+	app.ApiKey = credential.ApiKey
+	app.ApiSecret = credential.ApiSecret
 	return c.Status(201).JSON(app)
 }
 
@@ -50,16 +69,10 @@ func (h *AdminHandler) GetAllApps(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch apps"})
 	}
 
+	usage := h.bucketUsage()
 	for i := range apps {
 		for j := range apps[i].Buckets {
-			var total int64
-
-			h.DB.Model(&model.FileMetadata{}).
-				Where("bucket_id = ?", apps[i].Buckets[j].ID).
-				Select("COALESCE(SUM(file_size), 0)").
-				Scan(&total)
-
-			apps[i].Buckets[j].TotalSize = total
+			fillBucketUsage(&apps[i].Buckets[j], usage)
 		}
 	}
 
@@ -67,22 +80,89 @@ func (h *AdminHandler) GetAllApps(c *fiber.Ctx) error {
 	return c.JSON(apps)
 }
 
+// appUpdateRequest holds the settings an admin may change on an app. Usage
+// counters, credentials and buckets have their own endpoints.
+type appUpdateRequest struct {
+	AppName              string   `json:"app_name"`
+	IsActive             bool     `json:"is_active"`
+	MaxBytes             int64    `json:"max_bytes"`
+	MaxFiles             int64    `json:"max_files"`
+	MaxFileSize          int64    `json:"max_file_size"`
+	RequestsPerSecond    int      `json:"requests_per_second"`
+	ConcurrentUploads    int      `json:"concurrent_uploads"`
+	UploadBytesPerMinute int64    `json:"upload_bytes_per_minute"`
+	AllowedCIDRs         []string `json:"allowed_cidrs"`
+}
+
+// UpdateApp (PUT /api/v1/admin/apps/:id) changes an app's settings. Fields
+// missing from the body keep their value. The storage API caches rate limits
+// and allowed_cidrs per app, so changes to them take effect within 30 seconds.
 func (h *AdminHandler) UpdateApp(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var app model.App
 	if err := h.DB.First(&app, "id = ?", id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "App not found"})
 	}
-	c.BodyParser(&app)
-	h.DB.Save(&app)
 
-	h.Audit.LogEvent("ADMIN_APP_UPDATE", fmt.Sprintf("New App created: %s (ID: %s)", app.AppName, app.ID), "INFO")
+	req := appUpdateRequest{
+		AppName:              app.AppName,
+		IsActive:             app.IsActive,
+		MaxBytes:             app.MaxBytes,
+		MaxFiles:             app.MaxFiles,
+		MaxFileSize:          app.MaxFileSize,
+		RequestsPerSecond:    app.RequestsPerSecond,
+		ConcurrentUploads:    app.ConcurrentUploads,
+		UploadBytesPerMinute: app.UploadBytesPerMinute,
+		AllowedCIDRs:         app.AllowedCIDRs,
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.MaxBytes < 0 || req.MaxFiles < 0 || req.MaxFileSize < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Quotas cannot be negative"})
+	}
+	if req.RequestsPerSecond < 0 || req.ConcurrentUploads < 0 || req.UploadBytesPerMinute < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Rate limits cannot be negative"})
+	}
+	if err := validCIDRs(req.AllowedCIDRs); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	app.AppName = req.AppName
+	app.IsActive = req.IsActive
+	app.MaxBytes = req.MaxBytes
+	app.MaxFiles = req.MaxFiles
+	app.MaxFileSize = req.MaxFileSize
+	app.RequestsPerSecond = req.RequestsPerSecond
+	app.ConcurrentUploads = req.ConcurrentUploads
+	app.UploadBytesPerMinute = req.UploadBytesPerMinute
+	app.AllowedCIDRs = req.AllowedCIDRs
+
+	err := h.DB.Model(&app).Select("app_name", "is_active", "max_bytes", "max_files", "max_file_size",
+		"requests_per_second", "concurrent_uploads", "upload_bytes_per_minute", "allowed_cidrs").Updates(&app).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update app", "details": err.Error()})
+	}
+
+	h.Audit.LogEvent("ADMIN_APP_UPDATE", fmt.Sprintf("App updated: %s (ID: %s)", app.AppName, app.ID), "INFO")
 
 	return c.JSON(app)
 }
 
 func (h *AdminHandler) DeleteApp(c *fiber.Ctx) error {
-	h.DB.Delete(&model.App{}, "id = ?", c.Params("id"))
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Credentials of a deleted app must stop working at once
+		if err := tx.Delete(&model.ApiCredential{}, "app_id = ?", c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.ClientCertificate{}, "app_id = ?", c.Params("id")).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.App{}, "id = ?", c.Params("id")).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete app", "details": err.Error()})
+	}
 
 	h.Audit.LogEvent("ADMIN_APP_DELETE", fmt.Sprintf("App deleted ID: %s", c.Params("id")), "INFO")
 
@@ -98,7 +178,19 @@ func (h *AdminHandler) RegisterBucket(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Cuerpo inválido"})
 	}
 
+	if !compress.Valid(bucket.Compression) {
+		return c.Status(400).JSON(fiber.Map{"error": "Unsupported compression: use gzip, zstd or leave empty"})
+	}
+	if !service.ValidRetentionMode(bucket.RetentionMode) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid retention mode: use GOVERNANCE, COMPLIANCE or empty"})
+	}
+	if bucket.MaxBytes < 0 || bucket.MaxFiles < 0 || bucket.MaxFileSize < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Quotas cannot be negative"})
+	}
+
 	bucket.ID = uuid.New()
+	bucket.UsedBytes = 0
+	bucket.FileCount = 0
 	if err := h.DB.Create(&bucket).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "No se pudo crear el bucket: " + err.Error()})
 	}
@@ -111,22 +203,52 @@ func (h *AdminHandler) RegisterBucket(c *fiber.Ctx) error {
 // GetBucketsByApp (GET /api/v1/admin/buckets/app/:appId)
 func (h *AdminHandler) GetAllBuckets(c *fiber.Ctx) error {
 	var buckets []model.Bucket
-	h.DB.Find(&buckets)
-
 	h.DB.Preload("App").Find(&buckets)
-	for i := range buckets {
-		var total int64
-		h.DB.Model(&model.FileMetadata{}).
-			Where("bucket_id = ?", buckets[i].ID).
-			Select("COALESCE(SUM(file_size), 0)").
-			Scan(&total)
 
-		buckets[i].TotalSize = total
+	usage := h.bucketUsage()
+	for i := range buckets {
+		fillBucketUsage(&buckets[i], usage)
 	}
 
 	return c.JSON(buckets)
 }
 
+type quotaRequest struct {
+	MaxBytes    int64 `json:"max_bytes"`
+	MaxFiles    int64 `json:"max_files"`
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
+// UpdateBucketQuota (PUT /api/v1/admin/buckets/:id/quota) sets the limits of a
+// bucket. Zero means unlimited. Lowering a limit below the current usage only
+// blocks new writes.
+func (h *AdminHandler) UpdateBucketQuota(c *fiber.Ctx) error {
+	var req quotaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.MaxBytes < 0 || req.MaxFiles < 0 || req.MaxFileSize < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Quotas cannot be negative"})
+	}
+
+	result := h.DB.Model(&model.Bucket{}).Where("id = ?", c.Params("id")).Updates(map[string]interface{}{
+		"max_bytes":     req.MaxBytes,
+		"max_files":     req.MaxFiles,
+		"max_file_size": req.MaxFileSize,
+	})
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Bucket not found"})
+	}
+
+	var bucket model.Bucket
+	h.DB.First(&bucket, "id = ?", c.Params("id"))
+
+	h.Audit.LogEvent("ADMIN_BUCKET_QUOTA", fmt.Sprintf("Quota of bucket %s set to %d bytes, %d files, %d bytes per file",
+		bucket.Name, req.MaxBytes, req.MaxFiles, req.MaxFileSize), "INFO")
+
+	return c.JSON(bucket)
+}
+
 func (h *AdminHandler) GetBucketById(c *fiber.Ctx) error {
 	bucketId := c.Params("id")
 	var bucket model.Bucket
@@ -162,10 +284,40 @@ func (h *AdminHandler) GetBucketsByApp(c *fiber.Ctx) error {
 
 // --- UTILS ---
 
-func generateToken(n int) string {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return ""
+type bucketSizes struct {
+	BucketID   uuid.UUID
+	TotalSize  int64
+	StoredSize int64
+}
+
+// bucketUsage reads the logical (uncompressed) and stored sizes of every
+// bucket from the usage stats in a single query.
+func (h *AdminHandler) bucketUsage() map[uuid.UUID]bucketSizes {
+	var rows []bucketSizes
+	h.DB.Model(&model.UsageStat{}).
+		Select("bucket_id, SUM(bytes) AS total_size, SUM(stored_bytes) AS stored_size").
+		Group("bucket_id").
+		Scan(&rows)
+
+	usage := make(map[uuid.UUID]bucketSizes, len(rows))
+	for _, row := range rows {
+		usage[row.BucketID] = row
+	}
+	return usage
+}
+
+func fillBucketUsage(bucket *model.Bucket, usage map[uuid.UUID]bucketSizes) {
+	bucket.TotalSize = usage[bucket.ID].TotalSize
+	bucket.StoredSize = usage[bucket.ID].StoredSize
+}
+
+// validCIDRs checks an app's allowlist: networks in CIDR notation or single
+// addresses.
+func validCIDRs(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if cidr == "" || !service.ValidAllowedIP(cidr) {
+			return fmt.Errorf("invalid allowed_cidrs entry %q: use CIDR notation such as 10.20.0.0/16", cidr)
+		}
 	}
-	return hex.EncodeToString(b)
+	return nil
 }
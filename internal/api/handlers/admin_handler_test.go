@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/api/handlers"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestUpdateApp(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	other := env.newTenant("app-b", nil)
+
+	admin := handlers.NewAdminHandler(env.DB, &service.AuditService{})
+	app := fiber.New()
+	app.Put("/apps/:id", admin.UpdateApp)
+
+	update := func(body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/apps/"+tn.App.ID.String(), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := update(`{"allowed_cidrs": [`); got != 400 {
+		t.Errorf("malformed body: status %d, want 400", got)
+	}
+	if got := update(`{"allowed_cidrs": ["10.0.0.0/33"]}`); got != 400 {
+		t.Errorf("invalid CIDR: status %d, want 400", got)
+	}
+	if got := update(`{"id": "` + other.App.ID.String() + `", "app_name": "app-a", "allowed_cidrs": ["10.0.0.0/8"]}`); got != 200 {
+		t.Fatalf("valid update: status %d, want 200", got)
+	}
+
+	var stored, untouched model.App
+	env.DB.First(&stored, "id = ?", tn.App.ID)
+	env.DB.First(&untouched, "id = ?", other.App.ID)
+	if len(stored.AllowedCIDRs) != 1 || stored.AllowedCIDRs[0] != "10.0.0.0/8" {
+		t.Errorf("allowed_cidrs = %v, want [10.0.0.0/8]", stored.AllowedCIDRs)
+	}
+	if untouched.AppName != "app-b" || len(untouched.AllowedCIDRs) != 0 {
+		t.Errorf("the body's id retargeted the update: %+v", untouched)
+	}
+
+	for _, body := range []string{`{"max_bytes": -1}`, `{"max_files": -1}`, `{"max_file_size": -1}`,
+		`{"requests_per_second": -1}`, `{"concurrent_uploads": -1}`, `{"upload_bytes_per_minute": -1}`} {
+		if got := update(body); got != 400 {
+			t.Errorf("%s: status %d, want 400", body, got)
+		}
+	}
+
+	// Only the editable settings are written; omitted ones keep their value
+	if got := update(`{"max_files": 10, "used_bytes": 99, "file_count": 99, "buckets": [{"id": "` + uuid.NewString() + `", "name": "injected", "provider": "local"}]}`); got != 200 {
+		t.Fatalf("update with read-only fields: status %d, want 200", got)
+	}
+	env.DB.First(&stored, "id = ?", tn.App.ID)
+	if stored.MaxFiles != 10 || stored.UsedBytes != tn.App.UsedBytes || stored.FileCount != tn.App.FileCount {
+		t.Errorf("stored app = %+v, want max_files 10 and untouched usage", stored)
+	}
+	if len(stored.AllowedCIDRs) != 1 || stored.AppName != "app-a" {
+		t.Errorf("omitted fields changed: %+v", stored)
+	}
+	var buckets int64
+	env.DB.Model(&model.Bucket{}).Where("app_id = ?", tn.App.ID).Count(&buckets)
+	if buckets != 1 {
+		t.Errorf("app has %d buckets, want the body's buckets ignored", buckets)
+	}
+}
+
+func TestDeleteAppReportsFailure(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+
+	admin := handlers.NewAdminHandler(env.DB, &service.AuditService{})
+	app := fiber.New()
+	app.Delete("/apps/:id", admin.DeleteApp)
+
+	del := func() int {
+		resp, err := app.Test(httptest.NewRequest(http.MethodDelete, "/apps/"+tn.App.ID.String(), nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// The certificates table is gone, so the transaction fails halfway
+	if err := env.DB.Migrator().DropTable(&model.ClientCertificate{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := del(); got != 500 {
+		t.Fatalf("failed delete: status %d, want 500", got)
+	}
+	var credentials int64
+	env.DB.Model(&model.ApiCredential{}).Where("app_id = ?", tn.App.ID).Count(&credentials)
+	if credentials == 0 {
+		t.Fatal("credentials were deleted by the failed transaction")
+	}
+
+	if err := env.DB.AutoMigrate(&model.ClientCertificate{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := del(); got != 204 {
+		t.Fatalf("delete: status %d, want 204", got)
+	}
+	var apps int64
+	env.DB.Model(&model.App{}).Where("id = ?", tn.App.ID).Count(&apps)
+	if apps != 0 {
+		t.Fatal("app still exists after the delete")
+	}
+}
+
+func TestCredentialSecretsAreRedacted(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+
+	admin := handlers.NewAdminHandler(env.DB, &service.AuditService{})
+	app := fiber.New()
+	app.Post("/apps/:id/credentials", admin.CreateCredential)
+	app.Get("/apps/:id/credentials", admin.GetCredentials)
+	path := "/apps/" + tn.App.ID.String() + "/credentials"
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"label":"viewer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created model.ApiCredential
+	decode(t, resp, http.StatusCreated, &created)
+	if created.ApiSecret == "" {
+		t.Fatal("creation response has no secret")
+	}
+
+	// The secret shown once authenticates; only its hash is stored
+	decode(t, env.request(created, http.MethodGet, "/api/v1/storage/files/", nil, nil), http.StatusOK, nil)
+	var stored model.ApiCredential
+	env.DB.First(&stored, "id = ?", created.ID)
+	if stored.SecretHash == "" || strings.Contains(stored.SecretHash, created.ApiSecret) {
+		t.Fatalf("stored secret hash = %q", stored.SecretHash)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing := string(readBody(t, resp))
+	for _, leak := range []string{created.ApiSecret, stored.SecretHash, "api_secret", "secret_hash", "SecretHash", "SigningKey", "signing_key"} {
+		if strings.Contains(listing, leak) {
+			t.Errorf("credential listing contains %q: %s", leak, listing)
+		}
+	}
+	if !strings.Contains(listing, created.ApiKey) {
+		t.Errorf("credential listing lacks the key %s", created.ApiKey)
+	}
+}
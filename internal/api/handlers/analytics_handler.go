@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type usageTotals struct {
+	Bytes       int64 `json:"bytes"`
+	StoredBytes int64 `json:"stored_bytes"`
+	Files       int64 `json:"files"`
+}
+
+type appUsage struct {
+	AppID   uuid.UUID `json:"app_id"`
+	AppName string    `json:"app_name"`
+	usageTotals
+}
+
+type bucketUsage struct {
+	BucketID     uuid.UUID `json:"bucket_id"`
+	Name         string    `json:"name"`
+	AppID        uuid.UUID `json:"app_id"`
+	ProviderType string    `json:"provider_type"`
+	MaxBytes     int64     `json:"max_bytes"`
+	usageTotals
+}
+
+type providerUsage struct {
+	ProviderType string `json:"provider_type"`
+	usageTotals
+}
+
+type contentTypeUsage struct {
+	ContentType string `json:"content_type"`
+	usageTotals
+}
+
+type dailyUsage struct {
+	Day         string `json:"day"`
+	Bytes       int64  `json:"bytes"`
+	StoredBytes int64  `json:"stored_bytes"`
+	Files       int64  `json:"files"`
+	TotalBytes  int64  `json:"total_bytes"`
+	TotalStored int64  `json:"total_stored_bytes"`
+	TotalFiles  int64  `json:"total_files"`
+}
+
+const usageSums = "SUM(usage_stats.bytes) AS bytes, SUM(usage_stats.stored_bytes) AS stored_bytes, SUM(usage_stats.files) AS files"
+
+// GetAnalytics (GET /api/v1/storage/admin/analytics?app_id=&from=&to=)
+// reports current usage per app, bucket, provider and content type, and the
+// daily growth between from and to (YYYY-MM-DD, last 30 days by default).
+// Usage includes archived versions and trashed files, which still take space.
+func (h *AdminHandler) GetAnalytics(c *fiber.Ctx) error {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -30)
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid from date: use YYYY-MM-DD"})
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid to date: use YYYY-MM-DD"})
+		}
+	}
+	if to.Before(from) {
+		return c.Status(400).JSON(fiber.Map{"error": "from must not be after to"})
+	}
+
+	appID := c.Query("app_id")
+	if appID != "" {
+		if _, err := uuid.Parse(appID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+		}
+	}
+
+	stats := func() *gorm.DB {
+		query := h.DB.Model(&model.UsageStat{})
+		if appID != "" {
+			query = query.Where("usage_stats.app_id = ?", appID)
+		}
+		return query
+	}
+
+	var totals usageTotals
+	stats().Select("COALESCE(SUM(bytes), 0) AS bytes, COALESCE(SUM(stored_bytes), 0) AS stored_bytes, COALESCE(SUM(files), 0) AS files").
+		Scan(&totals)
+
+	var apps []appUsage
+	stats().Select("usage_stats.app_id, apps.app_name, " + usageSums).
+		Joins("JOIN apps ON apps.id = usage_stats.app_id").
+		Group("usage_stats.app_id, apps.app_name").
+		Order("bytes DESC").
+		Scan(&apps)
+
+	var buckets []bucketUsage
+	stats().Select("usage_stats.bucket_id, buckets.name, usage_stats.app_id, buckets.provider_type, buckets.max_bytes, " + usageSums).
+		Joins("JOIN buckets ON buckets.id = usage_stats.bucket_id").
+		Group("usage_stats.bucket_id, buckets.name, usage_stats.app_id, buckets.provider_type, buckets.max_bytes").
+		Order("bytes DESC").
+		Scan(&buckets)
+
+	var providers []providerUsage
+	stats().Select("buckets.provider_type, " + usageSums).
+		Joins("JOIN buckets ON buckets.id = usage_stats.bucket_id").
+		Group("buckets.provider_type").
+		Order("bytes DESC").
+		Scan(&providers)
+
+	var contentTypes []contentTypeUsage
+	stats().Select("usage_stats.content_type, " + usageSums).
+		Group("usage_stats.content_type").
+		Order("bytes DESC").
+		Scan(&contentTypes)
+
+	// Running totals start from everything recorded before the range
+	var before usageTotals
+	stats().Where("day < ?", from).
+		Select("COALESCE(SUM(bytes), 0) AS bytes, COALESCE(SUM(stored_bytes), 0) AS stored_bytes, COALESCE(SUM(files), 0) AS files").
+		Scan(&before)
+
+	var days []struct {
+		Day         time.Time
+		Bytes       int64
+		StoredBytes int64
+		Files       int64
+	}
+	stats().Where("day BETWEEN ? AND ?", from, to).
+		Select("day, " + usageSums).
+		Group("day").
+		Order("day").
+		Scan(&days)
+
+	daily := make([]dailyUsage, 0, len(days))
+	running := before
+	for _, d := range days {
+		running.Bytes += d.Bytes
+		running.StoredBytes += d.StoredBytes
+		running.Files += d.Files
+		daily = append(daily, dailyUsage{
+			Day:         d.Day.Format(time.DateOnly),
+			Bytes:       d.Bytes,
+			StoredBytes: d.StoredBytes,
+			Files:       d.Files,
+			TotalBytes:  running.Bytes,
+			TotalStored: running.StoredBytes,
+			TotalFiles:  running.Files,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"totals":        totals,
+		"apps":          apps,
+		"buckets":       buckets,
+		"providers":     providers,
+		"content_types": contentTypes,
+		"daily":         daily,
+		"from":          from.Format(time.DateOnly),
+		"to":            to.Format(time.DateOnly),
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type certificateRequest struct {
+	Subject     string   `json:"subject"`
+	Fingerprint string   `json:"fingerprint"` // SHA-256, hex, colons allowed
+	Label       string   `json:"label"`
+	Buckets     []string `json:"buckets"`
+	Permissions []string `json:"permissions"`
+}
+
+// GetCertificates (GET /api/v1/storage/admin/apps/:id/certificates)
+func (h *AdminHandler) GetCertificates(c *fiber.Ctx) error {
+	appID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+	}
+
+	var certificates []model.ClientCertificate
+	h.DB.Where("app_id = ?", appID).Order("created_at DESC").Find(&certificates)
+
+	return c.JSON(certificates)
+}
+
+// RegisterCertificate (POST /api/v1/storage/admin/apps/:id/certificates) maps a
+// client certificate, by subject DN or SHA-256 fingerprint, to the app.
+func (h *AdminHandler) RegisterCertificate(c *fiber.Ctx) error {
+	var req certificateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	req.Subject = strings.TrimSpace(req.Subject)
+	req.Fingerprint = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(req.Fingerprint), ":", ""))
+	if (req.Subject == "") == (req.Fingerprint == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "Set either subject or fingerprint"})
+	}
+	if req.Fingerprint != "" && !fingerprintPattern.MatchString(req.Fingerprint) {
+		return c.Status(400).JSON(fiber.Map{"error": "fingerprint must be a SHA-256 in hex"})
+	}
+
+	var app model.App
+	if err := h.DB.First(&app, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "App not found"})
+	}
+
+	// Scope is validated like the scope of an API credential
+	scope, err := h.credentialTemplate(app, credentialRequest{Label: req.Label, Buckets: req.Buckets, Permissions: req.Permissions})
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	query := h.DB.Model(&model.ClientCertificate{}).Where("revoked_at IS NULL")
+	if req.Fingerprint != "" {
+		query = query.Where("fingerprint = ?", req.Fingerprint)
+	} else {
+		query = query.Where("subject = ?", req.Subject)
+	}
+	var existing int64
+	query.Count(&existing)
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Certificate is already mapped"})
+	}
+
+	certificate := model.ClientCertificate{
+		ID:          uuid.New(),
+		AppID:       app.ID,
+		Subject:     req.Subject,
+		Fingerprint: req.Fingerprint,
+		Label:       scope.Label,
+		Buckets:     scope.Buckets,
+		Permissions: scope.Permissions,
+	}
+	if err := h.DB.Create(&certificate).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not register certificate"})
+	}
+
+	h.Audit.LogEvent("ADMIN_CERTIFICATE_REGISTER",
+		fmt.Sprintf("Client certificate %s mapped to app %s", certificate.Credential().ApiKey, app.AppName), "WARN")
+
+	return c.Status(201).JSON(certificate)
+}
+
+// RevokeCertificate (DELETE /api/v1/storage/admin/apps/:id/certificates/:certificateId)
+// disables a certificate mapping immediately.
+func (h *AdminHandler) RevokeCertificate(c *fiber.Ctx) error {
+	appID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+	}
+	certificateID, err := uuid.Parse(c.Params("certificateId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid certificate ID format"})
+	}
+
+	if err := h.Credentials.RevokeCertificate(appID, certificateID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Certificate not found or already revoked"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not revoke certificate"})
+	}
+
+	h.Audit.LogEvent("ADMIN_CERTIFICATE_REVOKE",
+		fmt.Sprintf("Client certificate %s of app %s revoked", c.Params("certificateId"), c.Params("id")), "WARN")
+
+	return c.SendStatus(204)
+}
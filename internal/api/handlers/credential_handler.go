@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultRotationGrace is how long old credentials keep working after a
+// rotation when the request does not say.
+const defaultRotationGrace = 24 * time.Hour
+
+type credentialRequest struct {
+	Label       string     `json:"label"`
+	Buckets     []string   `json:"buckets"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	GraceHours  *int       `json:"grace_hours"` // rotation only
+}
+
+// credentialTemplate validates the scope of a requested credential.
+func (h *AdminHandler) credentialTemplate(app model.App, req credentialRequest) (model.ApiCredential, error) {
+	for _, p := range req.Permissions {
+		switch p {
+		case model.PermissionRead, model.PermissionWrite, model.PermissionDelete, model.PermissionList,
+			model.PermissionBypassRetention, model.PermissionLegalHold:
+		default:
+			return model.ApiCredential{}, fmt.Errorf("unknown permission %q: use read, write, delete, list, bypass_retention or legal_hold", p)
+		}
+	}
+
+	if len(req.Buckets) > 0 {
+		var count int64
+		h.DB.Model(&model.Bucket{}).Where("app_id = ? AND name IN ?", app.ID, req.Buckets).Count(&count)
+		if int(count) != len(req.Buckets) {
+			return model.ApiCredential{}, errors.New("one or more buckets do not exist in this application")
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return model.ApiCredential{}, errors.New("expires_at must be in the future")
+	}
+
+	return model.ApiCredential{
+		AppID:       app.ID,
+		Label:       req.Label,
+		Buckets:     req.Buckets,
+		Permissions: req.Permissions,
+		ExpiresAt:   req.ExpiresAt,
+	}, nil
+}
+
+// CreateCredential (POST /api/v1/storage/admin/apps/:id/credentials) issues an
+// additional credential, optionally limited to some buckets and permissions,
+// e.g. a read-only key for a viewer. The secret is only shown in this response.
+func (h *AdminHandler) CreateCredential(c *fiber.Ctx) error {
+	var req credentialRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var app model.App
+	if err := h.DB.First(&app, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "App not found"})
+	}
+
+	template, err := h.credentialTemplate(app, req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	credential, err := h.Credentials.Issue(h.DB, template)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create credential"})
+	}
+
+	h.Audit.LogEvent("ADMIN_CREDENTIAL_CREATE",
+		fmt.Sprintf("Credential %s created for app %s (buckets: %v, permissions: %v)", credential.ApiKey, app.AppName, req.Buckets, req.Permissions), "WARN")
+
+	return c.Status(201).JSON(credential)
+}
+
+// GetCredentials (GET /api/v1/storage/admin/apps/:id/credentials) lists the
+// credentials of an app, without secrets.
+func (h *AdminHandler) GetCredentials(c *fiber.Ctx) error {
+	appID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+	}
+
+	var credentials []model.ApiCredential
+	h.DB.Where("app_id = ?", appID).Order("created_at DESC").Find(&credentials)
+
+	return c.JSON(credentials)
+}
+
+// RotateCredentials (POST /api/v1/storage/admin/apps/:id/credentials/rotate)
+// issues a new credential with the requested scope. The app's other
+// credentials keep working for grace_hours (24 by default, 0 to cut them off
+// now). The new secret is only shown in this response.
+func (h *AdminHandler) RotateCredentials(c *fiber.Ctx) error {
+	appID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+	}
+
+	var req credentialRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	grace := defaultRotationGrace
+	if req.GraceHours != nil {
+		if *req.GraceHours < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "grace_hours cannot be negative"})
+		}
+		grace = time.Duration(*req.GraceHours) * time.Hour
+	}
+
+	var app model.App
+	if err := h.DB.First(&app, "id = ?", appID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "App not found"})
+	}
+
+	template, err := h.credentialTemplate(app, req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	credential, err := h.Credentials.Rotate(template, grace)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not rotate credentials"})
+	}
+
+	h.Audit.LogEvent("ADMIN_CREDENTIAL_ROTATE",
+		fmt.Sprintf("Credentials of app %s rotated: new key %s, previous keys valid for %s", app.AppName, credential.ApiKey, grace), "WARN")
+
+	return c.Status(201).JSON(credential)
+}
+
+// RevokeCredential (DELETE /api/v1/storage/admin/apps/:id/credentials/:credentialId)
+// disables a credential immediately.
+func (h *AdminHandler) RevokeCredential(c *fiber.Ctx) error {
+	appID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid App ID format"})
+	}
+	credentialID, err := uuid.Parse(c.Params("credentialId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid credential ID format"})
+	}
+
+	if err := h.Credentials.Revoke(appID, credentialID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Credential not found or already revoked"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not revoke credential"})
+	}
+
+	h.Audit.LogEvent("ADMIN_CREDENTIAL_REVOKE", fmt.Sprintf("Credential %s of app %s revoked", credentialID, appID), "WARN")
+
+	return c.SendStatus(204)
+}
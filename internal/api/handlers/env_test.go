@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/config"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/api/routes"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/ratelimit"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testCipherKey = "0123456789abcdef0123456789abcdef"
+
+// testEnv is the storage API on an in-memory database, with buckets on the
+// MEMORY provider.
+type testEnv struct {
+	t   *testing.T
+	DB  *gorm.DB
+	App *fiber.App
+}
+
+// tenant is an app with one bucket and a credential for it.
+type tenant struct {
+	App        model.App
+	Bucket     model.Bucket
+	Credential model.ApiCredential
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	t.Setenv("STORAGE_CIPHER_KEY", testCipherKey)
+	t.Setenv("SHARE_BASE_URL", "https://storage.example.org")
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection keeps a single in-memory database for the whole test
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := config.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	routes.SetupRoutes(app, db, &service.AuditService{}, nil, ratelimit.NewMemoryBackend())
+
+	return &testEnv{t: t, DB: db, App: app}
+}
+
+// newTenant creates an app with a MEMORY bucket in its own namespace. The
+// bucket can be adjusted by mutate before it is stored.
+func (e *testEnv) newTenant(name string, mutate func(*model.Bucket)) tenant {
+	e.t.Helper()
+
+	app := model.App{ID: uuid.New(), AppName: name, IsActive: true}
+	if err := e.DB.Create(&app).Error; err != nil {
+		e.t.Fatal(err)
+	}
+
+	bucket := model.Bucket{
+		ID:           uuid.New(),
+		AppID:        app.ID,
+		Name:         name + "-records",
+		ProviderType: "MEMORY",
+		Config:       `{"namespace":"` + uuid.NewString() + `"}`,
+	}
+	if mutate != nil {
+		mutate(&bucket)
+	}
+	if err := e.DB.Create(&bucket).Error; err != nil {
+		e.t.Fatal(err)
+	}
+
+	return tenant{App: app, Bucket: bucket, Credential: e.issue(app, model.ApiCredential{})}
+}
+
+// issue creates a credential of app with the scope of template.
+func (e *testEnv) issue(app model.App, template model.ApiCredential) model.ApiCredential {
+	e.t.Helper()
+
+	template.AppID = app.ID
+	credential, err := service.NewCredentialService(e.DB).Issue(e.DB, template)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return credential
+}
+
+// request sends a request authenticated with credential's key and secret.
+func (e *testEnv) request(credential model.ApiCredential, method, path string, body []byte, headers map[string]string) *http.Response {
+	e.t.Helper()
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if credential.ApiKey != "" {
+		req.Header.Set("X-API-Key", credential.ApiKey)
+		req.Header.Set("X-API-Secret", credential.ApiSecret)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.App.Test(req, -1)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return resp
+}
+
+// upload stores data in the tenant's bucket through the API and returns the
+// new file ID.
+func (e *testEnv) upload(tn tenant, name string, data []byte) uuid.UUID {
+	e.t.Helper()
+
+	resp := e.request(tn.Credential, http.MethodPost, "/api/v1/storage/files/upload", data, map[string]string{
+		"X-Bucket-Name":       tn.Bucket.Name,
+		"X-Original-Filename": name,
+	})
+	var out struct {
+		FileID uuid.UUID `json:"file_id"`
+	}
+	decode(e.t, resp, http.StatusCreated, &out)
+	return out.FileID
+}
+
+// decode checks the status and decodes the JSON body into v, if given.
+func decode(t *testing.T, resp *http.Response, status int, v any) {
+	t.Helper()
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, status, body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("decoding %s: %v", body, err)
+		}
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
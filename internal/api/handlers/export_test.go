@@ -0,0 +1,11 @@
+package handlers
+
+import "github.com/JAreyes98/healthconnect-storage-service/internal/model"
+
+// ErrVersionConflict and WriteVersion let the external tests interleave
+// version writes.
+var ErrVersionConflict = errVersionConflict
+
+func (h *StorageHandler) WriteVersion(primary model.FileMetadata, data []byte, originalName string) (int, error) {
+	return h.writeVersion(primary, data, originalName)
+}
@@ -0,0 +1,143 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/google/uuid"
+)
+
+// memoryStore returns the MEMORY namespace behind a bucket.
+func memoryStore(t *testing.T, bucket model.Bucket) *storage.MemoryStore {
+	t.Helper()
+
+	var cfg storage.MemoryConfig
+	if err := json.Unmarshal([]byte(bucket.Config), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return storage.MemoryNamespace(cfg.Namespace)
+}
+
+func TestUploadFailureOnPrimaryReleasesQuota(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	store := memoryStore(t, tn.Bucket)
+	store.SetFaults(storage.MemoryFaults{FailOnCall: 1, Ops: []string{"upload"}})
+
+	resp := env.request(tn.Credential, http.MethodPost, "/api/v1/storage/files/upload", []byte("lost"), map[string]string{
+		"X-Bucket-Name":       tn.Bucket.Name,
+		"X-Original-Filename": "lost.txt",
+	})
+	decode(t, resp, http.StatusInternalServerError, nil)
+
+	var files int64
+	env.DB.Model(&model.FileMetadata{}).Where("bucket_id = ?", tn.Bucket.ID).Count(&files)
+	if files != 0 {
+		t.Fatalf("failed upload left %d metadata rows", files)
+	}
+	var bucket model.Bucket
+	env.DB.First(&bucket, "id = ?", tn.Bucket.ID)
+	if bucket.UsedBytes != 0 || bucket.FileCount != 0 {
+		t.Fatalf("failed upload kept its reservation: %d bytes, %d files", bucket.UsedBytes, bucket.FileCount)
+	}
+
+	// Only the first call fails
+	env.upload(tn, "kept.txt", []byte("kept"))
+	env.DB.First(&bucket, "id = ?", tn.Bucket.ID)
+	if bucket.UsedBytes != 4 || bucket.FileCount != 1 {
+		t.Fatalf("usage = %d bytes, %d files, want 4 and 1", bucket.UsedBytes, bucket.FileCount)
+	}
+}
+
+func TestUploadSkipsFailingReplica(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+
+	replica := model.Bucket{ID: uuid.New(), AppID: tn.App.ID, Name: "app-a-replica", ProviderType: "MEMORY", Config: `{"namespace":"` + uuid.NewString() + `"}`}
+	env.DB.Create(&replica)
+	env.DB.Create(&model.ReplicationRule{ID: uuid.New(), AppID: tn.App.ID, SourceBucketID: tn.Bucket.ID, TargetBucketID: replica.ID, Active: true})
+	replicaStore := memoryStore(t, replica)
+	replicaStore.SetFaults(storage.MemoryFaults{FailEvery: 1, Ops: []string{"upload"}})
+
+	fileID := env.upload(tn, "primary-only.txt", []byte("primary only"))
+	if replicaStore.Calls() != 1 {
+		t.Fatalf("replica received %d calls, want the one failed upload", replicaStore.Calls())
+	}
+
+	var copies []model.FileMetadata
+	env.DB.Where("id = ? OR replica_of = ?", fileID, fileID).Find(&copies)
+	if len(copies) != 1 || copies[0].BucketID != tn.Bucket.ID {
+		t.Fatalf("copies = %+v, want only the primary", copies)
+	}
+	var stored model.Bucket
+	env.DB.First(&stored, "id = ?", replica.ID)
+	if stored.UsedBytes != 0 || stored.FileCount != 0 {
+		t.Fatalf("failed replica kept its reservation: %d bytes, %d files", stored.UsedBytes, stored.FileCount)
+	}
+
+	resp := env.request(tn.Credential, http.MethodGet, "/api/v1/storage/files/download/"+fileID.String(), nil, nil)
+	if got := readBody(t, resp); string(got) != "primary only" {
+		t.Fatalf("download = %q", got)
+	}
+}
+
+func TestReadFaults(t *testing.T) {
+	env := newTestEnv(t)
+	plain := env.newTenant("app-a", nil)
+	sealed := env.newTenant("app-b", func(b *model.Bucket) { b.Cipher = true })
+
+	plainID := env.upload(plain, "plain.txt", []byte("plain content"))
+	sealedID := env.upload(sealed, "sealed.txt", []byte("sealed content"))
+
+	t.Run("provider error", func(t *testing.T) {
+		store := memoryStore(t, plain.Bucket)
+		store.SetFaults(storage.MemoryFaults{FailEvery: 1, Ops: []string{"download"}})
+		defer store.SetFaults(storage.MemoryFaults{})
+
+		for _, route := range []string{"view/", "download/"} {
+			resp := env.request(plain.Credential, http.MethodGet, "/api/v1/storage/files/"+route+plainID.String(), nil, nil)
+			decode(t, resp, http.StatusInternalServerError, nil)
+		}
+	})
+
+	t.Run("corrupted ciphertext", func(t *testing.T) {
+		store := memoryStore(t, sealed.Bucket)
+		store.SetFaults(storage.MemoryFaults{CorruptReads: true})
+		defer store.SetFaults(storage.MemoryFaults{})
+
+		for _, route := range []string{"view/", "download/"} {
+			resp := env.request(sealed.Credential, http.MethodGet, "/api/v1/storage/files/"+route+sealedID.String(), nil, nil)
+			body := readBody(t, resp)
+			if resp.StatusCode != http.StatusInternalServerError {
+				t.Fatalf("%s: status = %d, want 500: %s", route, resp.StatusCode, body)
+			}
+		}
+	})
+
+	// Both files read back once the faults are cleared
+	for id, tn := range map[uuid.UUID]tenant{plainID: plain, sealedID: sealed} {
+		resp := env.request(tn.Credential, http.MethodGet, "/api/v1/storage/files/view/"+id.String(), nil, nil)
+		decode(t, resp, http.StatusOK, nil)
+	}
+}
+
+func TestRestoreReportsFailedWrite(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	fileID := env.upload(tn, "report.pdf", []byte("report"))
+	path := "/api/v1/storage/files/" + fileID.String()
+
+	decode(t, env.request(tn.Credential, http.MethodDelete, path, nil, nil), http.StatusNoContent, nil)
+
+	// The database refuses every write to file metadata
+	if err := env.DB.Exec(`CREATE TRIGGER read_only BEFORE UPDATE ON file_metadata BEGIN SELECT RAISE(ABORT, 'read only'); END`).Error; err != nil {
+		t.Fatal(err)
+	}
+	decode(t, env.request(tn.Credential, http.MethodPost, path+"/restore", nil, nil), http.StatusInternalServerError, nil)
+
+	env.DB.Exec(`DROP TRIGGER read_only`)
+	decode(t, env.request(tn.Credential, http.MethodPost, path+"/restore", nil, nil), http.StatusOK, nil)
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UpdateFile (PUT /api/v1/storage/files/:id) stores the request body as a new
+// version of an existing file. The file keeps its ID; the previous content is
+// archived as a FileVersion on the primary and on every replica.
+func (h *StorageHandler) UpdateFile(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionWrite, meta.Bucket) {
+		return scopeJSON(c, model.PermissionWrite, meta.Bucket)
+	}
+
+	if h.checkBypass(c, meta.Bucket) {
+		return scopeJSON(c, model.PermissionBypassRetention, meta.Bucket)
+	}
+	if locked := h.checkLocks(c, meta, "Overwrite"); locked != nil {
+		return lockedJSON(c, meta.ID, locked)
+	}
+
+	var data []byte
+	var err error
+	stream := c.Context().RequestBodyStream()
+	if stream != nil {
+		data, err = io.ReadAll(stream)
+	} else {
+		data = c.Body()
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read upload stream"})
+	}
+
+	originalName := c.Get("X-Original-Filename")
+	if originalName == "" {
+		originalName = meta.OriginalName
+	}
+
+	version, err := h.writeVersion(meta, data, originalName)
+	var quota *service.QuotaError
+	if errors.As(err, &quota) {
+		return quotaJSON(c, err)
+	}
+	if errors.Is(err, errVersionConflict) {
+		return c.Status(409).JSON(fiber.Map{"error": "File was changed by another request, retry"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not store new version", "details": err.Error()})
+	}
+
+	h.Audit.LogEvent("FILE_VERSION_CREATE", fmt.Sprintf("File %s updated to version %d", meta.ID, version), "INFO")
+
+	return c.JSON(fiber.Map{
+		"message": "Version created",
+		"file_id": meta.ID,
+		"version": version,
+	})
+}
+
+// GetVersions (GET /api/v1/storage/files/:id/versions) lists every version of
+// a file, newest first.
+func (h *StorageHandler) GetVersions(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+
+	var versions []model.FileVersion
+	h.DB.Where("file_id = ?", meta.ID).Find(&versions)
+
+	versions = append(versions, currentVersion(meta))
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+
+	return c.JSON(versions)
+}
+
+// DownloadVersion (GET /api/v1/storage/files/:id/versions/:version) downloads
+// a specific version of a file.
+func (h *StorageHandler) DownloadVersion(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+
+	version, err := h.findVersion(meta, c.Params("version"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+
+	data, err := h.Blobs.Read(meta.Bucket, version.PhysicalPath, version.Compression)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not retrieve version from storage"})
+	}
+
+	h.touch(meta.ID)
+	h.Audit.LogEvent("FILE_DOWNLOAD", fmt.Sprintf("Downloading file ID: %s version %d", meta.ID, version.Version), "INFO")
+
+	contentType := mime.TypeByExtension(filepath.Ext(version.OriginalName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", version.OriginalName))
+	c.Set("Content-Type", contentType)
+	return c.Send(data)
+}
+
+// RestoreVersion (POST /api/v1/storage/files/:id/versions/:version/restore)
+// makes an earlier version current again by storing its content as a new
+// version, so the history is never rewritten.
+func (h *StorageHandler) RestoreVersion(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionWrite, meta.Bucket) {
+		return scopeJSON(c, model.PermissionWrite, meta.Bucket)
+	}
+
+	version, err := h.findVersion(meta, c.Params("version"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+	if version.IsCurrent {
+		return c.Status(409).JSON(fiber.Map{"error": "Version is already current"})
+	}
+
+	if h.checkBypass(c, meta.Bucket) {
+		return scopeJSON(c, model.PermissionBypassRetention, meta.Bucket)
+	}
+	if locked := h.checkLocks(c, meta, "Restore"); locked != nil {
+		return lockedJSON(c, meta.ID, locked)
+	}
+
+	data, err := h.Blobs.Read(meta.Bucket, version.PhysicalPath, version.Compression)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not retrieve version from storage"})
+	}
+
+	newVersion, err := h.writeVersion(meta, data, version.OriginalName)
+	var quota *service.QuotaError
+	if errors.As(err, &quota) {
+		return quotaJSON(c, err)
+	}
+	if errors.Is(err, errVersionConflict) {
+		return c.Status(409).JSON(fiber.Map{"error": "File was changed by another request, retry"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not restore version", "details": err.Error()})
+	}
+
+	h.Audit.LogEvent("FILE_VERSION_RESTORE",
+		fmt.Sprintf("File %s version %d restored as version %d", meta.ID, version.Version, newVersion), "INFO")
+
+	return c.JSON(fiber.Map{
+		"message":       "Version restored",
+		"file_id":       meta.ID,
+		"restored_from": version.Version,
+		"version":       newVersion,
+	})
+}
+
+// errVersionConflict is returned by writeVersion when another request stored
+// a version of the file first.
+var errVersionConflict = errors.New("file was changed by another request")
+
+// writeVersion stores data as the next version of a primary file and of each
+// of its replicas. A failure on the primary aborts; failed replicas are
+// audited and keep their previous version. If primary is no longer the
+// current version, nothing is changed and errVersionConflict is returned.
+func (h *StorageHandler) writeVersion(primary model.FileMetadata, data []byte, originalName string) (int, error) {
+	var copies []model.FileMetadata
+	h.DB.Preload("Bucket").Where("(id = ? OR replica_of = ?) AND app_id = ?", primary.ID, primary.ID, primary.AppID).Find(&copies)
+
+	next := primary.Version + 1
+	// Concurrent writers compute the same next version; the random suffix
+	// keeps each one's object apart, so a loser only releases its own
+	physicalName := fmt.Sprintf("%s.v%d.%s%s", primary.ID, next, uuid.NewString(), filepath.Ext(originalName))
+	contentType := detectContentType(originalName, data)
+
+	// Primary first, so replicas are only touched once the new version exists
+	sort.SliceStable(copies, func(i, j int) bool { return copies[i].ReplicaOf == nil && copies[j].ReplicaOf != nil })
+
+	size := int64(len(data))
+
+	for _, row := range copies {
+		// The archived version keeps its bytes, so the new content adds to usage
+		if err := h.Usage.Reserve(row.Bucket, size, 0); err != nil {
+			if row.ID == primary.ID {
+				return 0, err
+			}
+			h.Audit.LogEvent("QUOTA_EXCEEDED",
+				fmt.Sprintf("Version %d of file %s not stored in bucket %s: %v", next, primary.ID, row.Bucket.Name, err), "WARN")
+			continue
+		}
+
+		stored, err := h.Blobs.Put(row.Bucket, data, physicalName, contentType)
+		if err != nil {
+			h.Usage.Add(row.Bucket.ID, row.Bucket.AppID, -size, 0)
+			if row.ID == primary.ID {
+				return 0, err
+			}
+			h.Audit.LogEvent("REPLICATION_ERROR",
+				fmt.Sprintf("Failed to store version %d of file %s in bucket %s: %v", next, primary.ID, row.Bucket.Name, err), "ERROR")
+			continue
+		}
+
+		expected := row.Version
+		if row.ID == primary.ID {
+			expected = primary.Version
+		}
+		err = h.DB.Transaction(func(tx *gorm.DB) error {
+			// Only the writer that still sees the version it read moves the row
+			result := tx.Model(&model.FileMetadata{}).Where("id = ? AND version = ?", row.ID, expected).Updates(map[string]interface{}{
+				"version":       next,
+				"original_name": originalName,
+				"physical_path": stored.Path,
+				"file_size":     size,
+				"stored_size":   stored.StoredSize,
+				"content_type":  contentType,
+				"compression":   stored.Compression,
+				"content_hash":  stored.Hash,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errVersionConflict
+			}
+
+			archived := currentVersion(row)
+			archived.ID = uuid.New()
+			archived.FileID = row.ID
+			return tx.Create(&archived).Error
+		})
+		if err != nil {
+			h.Blobs.Release(row.Bucket, stored.Path, stored.Hash)
+			h.Usage.Add(row.Bucket.ID, row.Bucket.AppID, -size, 0)
+			if row.ID == primary.ID {
+				return 0, err
+			}
+			continue
+		}
+
+		h.Usage.Record(service.UsageChange{
+			BucketID:    row.BucketID,
+			AppID:       row.AppID,
+			ContentType: contentType,
+			Bytes:       size,
+			StoredBytes: stored.StoredSize,
+		})
+	}
+
+	return next, nil
+}
+
+func (h *StorageHandler) findVersion(meta model.FileMetadata, param string) (model.FileVersion, error) {
+	number, err := strconv.Atoi(param)
+	if err != nil {
+		return model.FileVersion{}, err
+	}
+
+	if number == meta.Version {
+		return currentVersion(meta), nil
+	}
+
+	var version model.FileVersion
+	err = h.DB.Where("file_id = ? AND version = ?", meta.ID, number).First(&version).Error
+	return version, err
+}
+
+// currentVersion describes the state held on the FileMetadata row itself.
+func currentVersion(meta model.FileMetadata) model.FileVersion {
+	createdAt := meta.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = meta.CreatedAt
+	}
+
+	return model.FileVersion{
+		FileID:       meta.ID,
+		Version:      meta.Version,
+		OriginalName: meta.OriginalName,
+		PhysicalPath: meta.PhysicalPath,
+		FileSize:     meta.FileSize,
+		StoredSize:   meta.StoredSize,
+		ContentType:  meta.ContentType,
+		Compression:  meta.Compression,
+		ContentHash:  meta.ContentHash,
+		CreatedAt:    createdAt,
+		IsCurrent:    true,
+	}
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/api/handlers"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+)
+
+func TestConcurrentVersionWriteLosesCleanly(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	fileID := env.upload(tn, "chart.txt", []byte("version 1"))
+
+	// Both writers read version 1 before either stores version 2
+	var stale model.FileMetadata
+	env.DB.Preload("Bucket").First(&stale, "id = ?", fileID)
+
+	path := "/api/v1/storage/files/" + fileID.String()
+	decode(t, env.request(tn.Credential, http.MethodPut, path, []byte("winner"), nil), http.StatusOK, nil)
+
+	h := handlers.NewStorageHandler(env.DB, &service.AuditService{})
+	if _, err := h.WriteVersion(stale, []byte("loser"), "chart.txt"); !errors.Is(err, handlers.ErrVersionConflict) {
+		t.Fatalf("stale write: err = %v, want a version conflict", err)
+	}
+
+	var meta model.FileMetadata
+	env.DB.First(&meta, "id = ?", fileID)
+	if meta.Version != 2 {
+		t.Fatalf("version = %d, want the winner's 2", meta.Version)
+	}
+	resp := env.request(tn.Credential, http.MethodGet, "/api/v1/storage/files/download/"+fileID.String(), nil, nil)
+	if got := readBody(t, resp); string(got) != "winner" {
+		t.Fatalf("content = %q, want the winner's", got)
+	}
+	resp = env.request(tn.Credential, http.MethodGet, path+"/versions/1", nil, nil)
+	if got := readBody(t, resp); string(got) != "version 1" {
+		t.Fatalf("archived version 1 = %q", got)
+	}
+
+	var archived int64
+	env.DB.Model(&model.FileVersion{}).Where("file_id = ?", fileID).Count(&archived)
+	if archived != 1 {
+		t.Fatalf("archived versions = %d, want 1", archived)
+	}
+	var bucket model.Bucket
+	env.DB.First(&bucket, "id = ?", tn.Bucket.ID)
+	if want := int64(len("version 1") + len("winner")); bucket.UsedBytes != want {
+		t.Fatalf("used bytes = %d, want %d: the loser's reservation was kept", bucket.UsedBytes, want)
+	}
+	if objects := memoryStore(t, tn.Bucket).Size(); objects != int64(len("version 1")+len("winner")) {
+		t.Fatalf("stored bytes = %d, the loser's object was left behind", objects)
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import "github.com/JAreyes98/healthconnect-storage-service/internal/model"
+
+// fileView is a file as the storage API returns it. The preloaded bucket is
+// replaced by its name: its config holds the provider credentials and must
+// never reach app clients.
+type fileView struct {
+	model.FileMetadata
+	Bucket string `json:"bucket,omitempty"`
+}
+
+func newFileView(meta model.FileMetadata) fileView {
+	return fileView{FileMetadata: meta, Bucket: meta.Bucket.Name}
+}
+
+func newFileViews(files []model.FileMetadata) []fileView {
+	views := make([]fileView, len(files))
+	for i, f := range files {
+		views[i] = newFileView(f)
+	}
+	return views
+}
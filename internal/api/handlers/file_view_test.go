@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestFileViewOmitsBucketConfig(t *testing.T) {
+	meta := model.FileMetadata{
+		ID:           uuid.New(),
+		OriginalName: "report.pdf",
+		Bucket: model.Bucket{
+			Name:   "records",
+			Config: `{"secret_key":"provider-secret"}`,
+			App:    model.App{AppName: "clinic"},
+		},
+	}
+
+	body, err := json.Marshal(newFileView(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "provider-secret") || strings.Contains(string(body), "clinic") {
+		t.Fatalf("file view leaks bucket internals: %s", body)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["bucket"] != "records" {
+		t.Fatalf("bucket = %v, want the bucket name", decoded["bucket"])
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type LifecycleHandler struct {
+	DB *gorm.DB
+}
+
+func NewLifecycleHandler(db *gorm.DB) *LifecycleHandler {
+	return &LifecycleHandler{DB: db}
+}
+
+// CreateRule (POST /api/v1/storage/admin/lifecycle)
+func (h *LifecycleHandler) CreateRule(c *fiber.Ctx) error {
+	var rule model.LifecycleRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if rule.Basis == "" {
+		rule.Basis = service.LifecycleBasisCreated
+	}
+	if rule.Basis != service.LifecycleBasisCreated && rule.Basis != service.LifecycleBasisLastAccess {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid basis: use CREATED or LAST_ACCESS"})
+	}
+	if rule.AfterDays <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "afterDays must be greater than zero"})
+	}
+
+	var bucket model.Bucket
+	if err := h.DB.First(&bucket, "id = ?", rule.BucketID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Bucket not found"})
+	}
+
+	switch rule.Action {
+	case service.LifecycleTransition:
+		if rule.TargetBucketID == nil || *rule.TargetBucketID == rule.BucketID {
+			return c.Status(400).JSON(fiber.Map{"error": "TRANSITION needs a target bucket different from the source"})
+		}
+
+		// Files never leave their application
+		var count int64
+		h.DB.Model(&model.Bucket{}).Where("id = ? AND app_id = ?", *rule.TargetBucketID, bucket.AppID).Count(&count)
+		if count == 0 {
+			return c.Status(404).JSON(fiber.Map{"error": "Target bucket not found or does not belong to this application"})
+		}
+	case service.LifecycleDelete:
+		rule.TargetBucketID = nil
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid action: use TRANSITION or DELETE"})
+	}
+
+	rule.ID = uuid.New()
+	rule.AppID = bucket.AppID
+	rule.Active = true
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create lifecycle rule"})
+	}
+
+	return c.Status(201).JSON(rule)
+}
+
+// GetRules (GET /api/v1/storage/admin/lifecycle)
+func (h *LifecycleHandler) GetRules(c *fiber.Ctx) error {
+	var rules []model.LifecycleRule
+	h.DB.Preload("Bucket").Preload("TargetBucket").Find(&rules)
+	return c.JSON(rules)
+}
+
+// GetRulesByBucket (GET /api/v1/storage/admin/lifecycle/bucket/:bucketId)
+func (h *LifecycleHandler) GetRulesByBucket(c *fiber.Ctx) error {
+	bucketID, err := uuid.Parse(c.Params("bucketId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid Bucket ID format"})
+	}
+
+	var rules []model.LifecycleRule
+	h.DB.Preload("TargetBucket").Where("bucket_id = ?", bucketID).Find(&rules)
+	return c.JSON(rules)
+}
+
+// DeleteRule (DELETE /api/v1/storage/admin/lifecycle/:id)
+func (h *LifecycleHandler) DeleteRule(c *fiber.Ctx) error {
+	result := h.DB.Delete(&model.LifecycleRule{}, "id = ?", c.Params("id"))
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Rule not found"})
+	}
+
+	return c.SendStatus(204)
+}
+
+// ToggleRule (PATCH /api/v1/storage/admin/lifecycle/:id/toggle)
+func (h *LifecycleHandler) ToggleRule(c *fiber.Ctx) error {
+	var rule model.LifecycleRule
+	if err := h.DB.First(&rule, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rule not found"})
+	}
+
+	rule.Active = !rule.Active
+	h.DB.Model(&rule).Update("active", rule.Active)
+
+	return c.JSON(fiber.Map{"status": "updated", "active": rule.Active})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const defaultPresignTTL = 15 * time.Minute
+
+// maxUploadTTL caps presigned PUTs. The provider keeps honouring the URL after
+// the upload is completed, so it must expire soon.
+const maxUploadTTL = 15 * time.Minute
+
+type directUploadRequest struct {
+	Bucket      string `json:"bucket"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	ExpiresIn   string `json:"expires_in"` // URL lifetime; 15m by default and at most
+}
+
+// BeginDirectUpload (POST /api/v1/storage/files/uploads) presigns a PUT so the
+// client uploads straight to the provider. The file only exists once the
+// client calls CompleteDirectUpload. X-Expires-At / X-Expires-In set the
+// file's TTL as for normal uploads.
+func (h *StorageHandler) BeginDirectUpload(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var req directUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Filename == "" || req.Size <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "filename and a positive size are required"})
+	}
+
+	ttl := defaultPresignTTL
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = parseLinkTTL(req.ExpiresIn); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if ttl > maxUploadTTL {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("expires_in must be at most %s for uploads", maxUploadTTL)})
+		}
+	}
+
+	var bucket model.Bucket
+	if err := h.DB.Where("app_id = ? AND name = ?", appID, req.Bucket).First(&bucket).Error; err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Bucket not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionWrite, bucket) {
+		return scopeJSON(c, model.PermissionWrite, bucket)
+	}
+
+	fileExpiresAt, err := parseExpiry(c, bucket, time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = detectContentType(req.Filename, nil)
+	}
+
+	credentialID, _ := c.Locals("credential_id").(uuid.UUID)
+	upload, presigned, err := h.Presign.BeginUpload(model.PendingUpload{
+		AppID:         appID,
+		BucketID:      bucket.ID,
+		Bucket:        bucket,
+		CredentialID:  credentialID,
+		OriginalName:  req.Filename,
+		ContentType:   contentType,
+		Size:          req.Size,
+		FileExpiresAt: fileExpiresAt,
+	}, ttl)
+	if err != nil {
+		return directTransferJSON(c, err)
+	}
+
+	h.Audit.LogEvent("FILE_DIRECT_UPLOAD_BEGIN",
+		fmt.Sprintf("Direct upload %s of %s (%d bytes) to bucket %s presigned", upload.ID, req.Filename, req.Size, bucket.Name), "INFO")
+
+	return c.Status(201).JSON(fiber.Map{
+		"upload_id": upload.ID,
+		"upload":    presigned,
+		"complete":  "/api/v1/storage/files/uploads/" + upload.ID.String() + "/complete",
+	})
+}
+
+// CompleteDirectUpload (POST /api/v1/storage/files/uploads/:id/complete) is
+// the completion callback: it verifies the stored object and creates the
+// file.
+func (h *StorageHandler) CompleteDirectUpload(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	uploadID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid upload ID format"})
+	}
+
+	file, err := h.Presign.CompleteUpload(appID, uploadID)
+	if err != nil {
+		if !errors.Is(err, service.ErrUploadNotFound) {
+			h.Audit.LogEvent("FILE_DIRECT_UPLOAD_FAILED", fmt.Sprintf("Direct upload %s refused: %v", uploadID, err), "WARN")
+		}
+		return directTransferJSON(c, err)
+	}
+
+	h.Audit.LogEvent("FILE_UPLOAD", fmt.Sprintf("File %s uploaded directly to the provider (%d bytes)", file.OriginalName, file.FileSize), "INFO")
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Upload successful",
+		"file_id": file.ID,
+	})
+}
+
+// PresignDownload (GET /api/v1/storage/files/:id/presign?expires_in=15m)
+// returns a URL that downloads the stored object straight from the provider.
+func (h *StorageHandler) PresignDownload(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	ttl := defaultPresignTTL
+	if v := c.Query("expires_in"); v != "" {
+		var err error
+		if ttl, err = parseLinkTTL(v); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+
+	presigned, err := h.Presign.PresignDownload(meta, ttl)
+	if err != nil {
+		return directTransferJSON(c, err)
+	}
+
+	h.touch(meta.ID)
+	h.Audit.LogEvent("FILE_DOWNLOAD", fmt.Sprintf("Presigned download of file ID: %s until %s", meta.ID, presigned.ExpiresAt.UTC().Format(time.RFC3339)), "INFO")
+
+	return c.JSON(presigned)
+}
+
+func directTransferJSON(c *fiber.Ctx, err error) error {
+	var quota *service.QuotaError
+	switch {
+	case errors.As(err, &quota):
+		return quotaJSON(c, err)
+	case errors.Is(err, service.ErrDirectTransfer):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUploadNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Upload not found"})
+	case errors.Is(err, service.ErrUploadMismatch):
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Direct transfer failed", "details": err.Error()})
+	}
+}
@@ -0,0 +1,26 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDirectUploadURLLifetimeIsCapped(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	for expiresIn, status := range map[string]int{
+		"16m": http.StatusBadRequest,
+		"24h": http.StatusBadRequest,
+		// Within the cap the request reaches the provider check; MEMORY cannot presign
+		"15m": http.StatusConflict,
+		"":    http.StatusConflict,
+	} {
+		t.Run("expires_in="+expiresIn, func(t *testing.T) {
+			body := `{"bucket":"` + tn.Bucket.Name + `","filename":"scan.dcm","size":1024,"expires_in":"` + expiresIn + `"}`
+			resp := env.request(tn.Credential, http.MethodPost, "/api/v1/storage/files/uploads", []byte(body), headers)
+			decode(t, resp, status, nil)
+		})
+	}
+}
@@ -4,18 +4,20 @@ import (
 	"path/filepath"
 
 	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
-	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type ReplicationHandler struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Blobs *service.BlobService
+	Usage *service.UsageService
 }
 
 func NewReplicationHandler(db *gorm.DB) *ReplicationHandler {
-	return &ReplicationHandler{DB: db}
+	return &ReplicationHandler{DB: db, Blobs: service.NewBlobService(db), Usage: service.NewUsageService(db)}
 }
 
 func (h *ReplicationHandler) CreateRule(c *fiber.Ctx) error {
@@ -29,13 +31,20 @@ func (h *ReplicationHandler) CreateRule(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Source and Target buckets must be different"})
 	}
 
-	// 2. Security validation: Verify both buckets exist and belong to the same App
-	var count int64
-	h.DB.Model(&model.Bucket{}).Where("id IN ? AND app_id = ?",
-		[]uuid.UUID{rule.SourceBucketID, rule.TargetBucketID}, rule.AppID).Count(&count)
+	// 2. Security validation: the rule belongs to the source bucket's App and
+	// the target must be in that same App; the body's appId is not trusted
+	var source model.Bucket
+	if err := h.DB.First(&source, "id = ?", rule.SourceBucketID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Source bucket not found"})
+	}
+	if rule.AppID != uuid.Nil && rule.AppID != source.AppID {
+		return c.Status(400).JSON(fiber.Map{"error": "Source bucket does not belong to this application"})
+	}
 
-	if count != 2 {
-		return c.Status(404).JSON(fiber.Map{"error": "One or both buckets not found or do not belong to this application"})
+	var count int64
+	h.DB.Model(&model.Bucket{}).Where("id = ? AND app_id = ?", rule.TargetBucketID, source.AppID).Count(&count)
+	if count == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Target bucket not found or does not belong to this application"})
 	}
 
 	// 3. Prevent duplicate rules
@@ -47,6 +56,7 @@ func (h *ReplicationHandler) CreateRule(c *fiber.Ctx) error {
 	}
 
 	rule.ID = uuid.New()
+	rule.AppID = source.AppID
 	rule.Active = true
 
 	if err := h.DB.Create(&rule).Error; err != nil {
@@ -97,10 +107,15 @@ func (h *ReplicationHandler) ToggleRule(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var rule model.ReplicationRule
 
-	if err := h.DB.Preload("TargetBucket").First(&rule, "id = ?", id).Error; err != nil {
+	if err := h.DB.Preload("SourceBucket").Preload("TargetBucket").First(&rule, "id = ?", id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Regla no encontrada"})
 	}
 
+	// Reglas antiguas podían cruzar aplicaciones; no se reactivan
+	if !rule.Active && !sameApp(rule) {
+		return c.Status(409).JSON(fiber.Map{"error": "Rule replicates across applications and cannot be activated"})
+	}
+
 	rule.Active = !rule.Active
 	h.DB.Save(&rule)
 
@@ -113,11 +128,20 @@ func (h *ReplicationHandler) ToggleRule(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "updated", "active": rule.Active})
 }
 
-// ToggleRule (PATCH /api/v1/admin/replication/:id/toggle)
+// sameApp reports whether both buckets of a preloaded rule belong to its App.
+func sameApp(rule model.ReplicationRule) bool {
+	return rule.SourceBucket.AppID == rule.AppID && rule.TargetBucket.AppID == rule.AppID
+}
+
+// SyncBuckets copies the files missing in the target bucket of a rule.
 func (h *ReplicationHandler) SyncBuckets(rule model.ReplicationRule) {
+	if !sameApp(rule) {
+		return
+	}
+
 	// 1. Buscar archivos en el bucket origen
 	var sourceFiles []model.FileMetadata
-	h.DB.Where("bucket_id = ?", rule.SourceBucketID).Find(&sourceFiles)
+	h.DB.Where("bucket_id = ? AND app_id = ?", rule.SourceBucketID, rule.AppID).Find(&sourceFiles)
 
 	for _, file := range sourceFiles {
 		// 2. Verificar si ya existe en el bucket destino (por OriginalName o un Hash si lo tuvieras)
@@ -134,26 +158,25 @@ func (h *ReplicationHandler) SyncBuckets(rule model.ReplicationRule) {
 }
 
 func (h *ReplicationHandler) replicateMissingFile(file model.FileMetadata, rule model.ReplicationRule) {
-	// Obtenemos el bucket origen para saber cómo descargar
-	var sourceBucket model.Bucket
-	h.DB.First(&sourceBucket, "id = ?", rule.SourceBucketID)
-
-	sourceStrat, ok1 := storage.GetStrategy(sourceBucket.ProviderType)
-	targetStrat, ok2 := storage.GetStrategy(rule.TargetBucket.ProviderType)
-
-	if !ok1 || !ok2 {
-		return
-	}
-	// A. Descargar del origen
-	reader, err := sourceStrat.Download(file.PhysicalPath, sourceBucket.Config)
+	// A. Descargar del origen (descifrado si el bucket origen cifra)
+	data, err := h.Blobs.Read(rule.SourceBucket, file.PhysicalPath, file.Compression)
 	if err != nil {
 		return
 	}
-	defer reader.Close()
 
-	// B. Subir al destino (El nombre físico se mantiene para consistencia)
-	newPath, err := targetStrat.Upload(reader, filepath.Base(file.PhysicalPath), rule.TargetBucket.Config, rule.TargetBucket.Cipher)
+	primaryID := file.ID
+	if file.ReplicaOf != nil {
+		primaryID = *file.ReplicaOf
+	}
+
+	// B. Subir al destino con el nombre que usa UploadFile. La ruta de origen
+	// no sirve: en un bucket con dedup es el hash, compartido entre archivos.
+	if err := h.Usage.Reserve(rule.TargetBucket, file.FileSize, 1); err != nil {
+		return
+	}
+	stored, err := h.Blobs.Put(rule.TargetBucket, data, primaryID.String()+filepath.Ext(file.OriginalName), file.ContentType)
 	if err != nil {
+		h.Usage.Add(rule.TargetBucket.ID, rule.TargetBucket.AppID, -file.FileSize, -1)
 		return
 	}
 
@@ -163,8 +186,21 @@ func (h *ReplicationHandler) replicateMissingFile(file model.FileMetadata, rule
 		AppID:        file.AppID,
 		BucketID:     rule.TargetBucketID,
 		OriginalName: file.OriginalName,
-		PhysicalPath: newPath,
+		PhysicalPath: stored.Path,
 		FileSize:     file.FileSize,
+		StoredSize:   stored.StoredSize,
+		ContentType:  file.ContentType,
+		Compression:  stored.Compression,
+		ContentHash:  stored.Hash,
+		ReplicaOf:    &primaryID,
+		Version:      file.Version,
+		// Replicas inherit the source's holds so mirror deletes stay blocked
+		RetentionMode: file.RetentionMode,
+		RetainUntil:   file.RetainUntil,
+		LegalHold:     file.LegalHold,
+		ExpiresAt:     file.ExpiresAt,
+	}
+	if err := h.DB.Create(&newMeta).Error; err == nil {
+		h.Usage.Record(service.FileUsage(newMeta, 1))
 	}
-	h.DB.Create(&newMeta)
 }
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/api/handlers"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/google/uuid"
+)
+
+func TestSyncFromDedupBucketKeepsReplicasApart(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", func(b *model.Bucket) { b.Dedup = true })
+
+	content := []byte("same report, two patients")
+	first := env.upload(tn, "first.pdf", content)
+	second := env.upload(tn, "second.pdf", content)
+
+	target := model.Bucket{ID: uuid.New(), AppID: tn.App.ID, Name: "app-a-mirror", ProviderType: "MEMORY", Config: `{"namespace":"` + uuid.NewString() + `"}`}
+	env.DB.Create(&target)
+	rule := model.ReplicationRule{ID: uuid.New(), AppID: tn.App.ID, SourceBucketID: tn.Bucket.ID, TargetBucketID: target.ID, Active: true}
+	env.DB.Create(&rule)
+	env.DB.Preload("SourceBucket").Preload("TargetBucket").First(&rule, "id = ?", rule.ID)
+
+	handlers.NewReplicationHandler(env.DB).SyncBuckets(rule)
+
+	replicas := map[uuid.UUID]model.FileMetadata{}
+	var rows []model.FileMetadata
+	env.DB.Preload("Bucket").Where("bucket_id = ?", target.ID).Find(&rows)
+	for _, r := range rows {
+		replicas[*r.ReplicaOf] = r
+	}
+	if len(replicas) != 2 || replicas[first].PhysicalPath == replicas[second].PhysicalPath {
+		t.Fatalf("replicas = %+v, want one object per file", rows)
+	}
+
+	// Deleting one replica leaves the other's bytes
+	blobs := service.NewBlobService(env.DB)
+	if err := blobs.Destroy(replicas[first]); err != nil {
+		t.Fatal(err)
+	}
+	survivor := replicas[second]
+	if data, err := blobs.Read(target, survivor.PhysicalPath, survivor.Compression); err != nil || string(data) != string(content) {
+		t.Fatalf("surviving replica: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type legalHoldRequest struct {
+	Hold   bool   `json:"hold"`
+	Reason string `json:"reason"`
+}
+
+type retentionRequest struct {
+	Mode        string     `json:"mode"`
+	RetainUntil *time.Time `json:"retain_until"`
+}
+
+// SetLegalHold (PUT /api/v1/storage/files/:id/legal-hold) places or releases a
+// legal hold on a file and all its replicas. Trashed files can be held too,
+// which keeps them from being purged. Needs the legal_hold permission.
+func (h *StorageHandler) SetLegalHold(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var req legalHoldRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var meta model.FileMetadata
+	if err := h.DB.Unscoped().Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionLegalHold, meta.Bucket) {
+		return scopeJSON(c, model.PermissionLegalHold, meta.Bucket)
+	}
+
+	h.DB.Unscoped().Model(&model.FileMetadata{}).
+		Where("(id = ? OR replica_of = ?) AND app_id = ?", meta.ID, meta.ID, meta.AppID).
+		Update("legal_hold", req.Hold)
+
+	action := "FILE_LEGAL_HOLD_RELEASED"
+	if req.Hold {
+		action = "FILE_LEGAL_HOLD_SET"
+	}
+	h.Audit.LogEvent(action, fmt.Sprintf("Legal hold on file %s set to %t by app %s. Reason: %s", meta.ID, req.Hold, appID, req.Reason), "WARN")
+
+	return c.JSON(fiber.Map{"file_id": meta.ID, "legal_hold": req.Hold})
+}
+
+// SetRetention (PUT /api/v1/storage/files/:id/retention) changes the retention
+// of a file and all its replicas. Retention can always be extended.
+// Compliance retention cannot be shortened, removed or downgraded; governance
+// retention can, only with X-Bypass-Governance-Retention: true.
+func (h *StorageHandler) SetRetention(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var req retentionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if !service.ValidRetentionMode(req.Mode) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid retention mode: use GOVERNANCE, COMPLIANCE or empty"})
+	}
+	if (req.Mode == "") != (req.RetainUntil == nil) {
+		return c.Status(400).JSON(fiber.Map{"error": "mode and retain_until must be set together"})
+	}
+
+	var meta model.FileMetadata
+	if err := h.DB.Unscoped().Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionWrite, meta.Bucket) {
+		return scopeJSON(c, model.PermissionWrite, meta.Bucket)
+	}
+	if h.checkBypass(c, meta.Bucket) {
+		return scopeJSON(c, model.PermissionBypassRetention, meta.Bucket)
+	}
+
+	// Replicas can hold a later date or a stricter mode from their own
+	// bucket's default, so every copy must allow the change
+	var copies []model.FileMetadata
+	h.DB.Unscoped().Where("(id = ? OR replica_of = ?) AND app_id = ?", meta.ID, meta.ID, meta.AppID).Find(&copies)
+
+	now := time.Now()
+	weakens := false
+	for _, row := range copies {
+		if !weakensRetention(row, req, now) {
+			continue
+		}
+		if row.RetentionMode == service.RetentionCompliance || !bypassGovernance(c) {
+			return c.Status(423).JSON(fiber.Map{
+				"error":   "Retention cannot be shortened or removed",
+				"file_id": meta.ID,
+				"details": fmt.Sprintf("%s retention until %s on copy %s", row.RetentionMode, row.RetainUntil.UTC().Format(time.RFC3339), row.ID),
+			})
+		}
+		weakens = true
+	}
+
+	err := h.DB.Unscoped().Model(&model.FileMetadata{}).
+		Where("(id = ? OR replica_of = ?) AND app_id = ?", meta.ID, meta.ID, meta.AppID).
+		Updates(map[string]interface{}{"retention_mode": req.Mode, "retain_until": req.RetainUntil}).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update retention"})
+	}
+
+	until := "none"
+	if req.RetainUntil != nil {
+		until = req.RetainUntil.UTC().Format(time.RFC3339)
+	}
+	h.Audit.LogEvent("FILE_RETENTION_SET",
+		fmt.Sprintf("Retention on file %s set to %s until %s by app %s (bypass: %t)", meta.ID, req.Mode, until, appID, weakens), "WARN")
+
+	return c.JSON(fiber.Map{"file_id": meta.ID, "retention_mode": req.Mode, "retain_until": req.RetainUntil})
+}
+
+// weakensRetention reports whether req shortens, removes or downgrades the
+// active retention of file.
+func weakensRetention(file model.FileMetadata, req retentionRequest, now time.Time) bool {
+	if file.RetainUntil == nil || !now.Before(*file.RetainUntil) {
+		return false
+	}
+	return req.RetainUntil == nil || req.RetainUntil.Before(*file.RetainUntil) ||
+		(file.RetentionMode == service.RetentionCompliance && req.Mode != service.RetentionCompliance)
+}
+
+func bypassGovernance(c *fiber.Ctx) bool {
+	return c.Get("X-Bypass-Governance-Retention") == "true"
+}
+
+// checkBypass reports whether the request asks to bypass governance retention
+// without the bypass_retention permission, auditing the refusal.
+func (h *StorageHandler) checkBypass(c *fiber.Ctx, bucket model.Bucket) bool {
+	return bypassGovernance(c) && h.checkScope(c, model.PermissionBypassRetention, bucket)
+}
+
+// checkLocks looks for legal holds and retention on every copy of a primary
+// file and returns the lock that refuses the operation, or nil.
+func (h *StorageHandler) checkLocks(c *fiber.Ctx, primary model.FileMetadata, operation string) *service.LockedError {
+	var copies []model.FileMetadata
+	h.DB.Where("(id = ? OR replica_of = ?) AND app_id = ?", primary.ID, primary.ID, primary.AppID).Find(&copies)
+
+	bypass := bypassGovernance(c)
+	err := service.CheckLocks(copies, bypass, time.Now())
+
+	var locked *service.LockedError
+	if errors.As(err, &locked) {
+		h.Audit.LogEvent("FILE_LOCK_BLOCKED", fmt.Sprintf("%s of file %s refused: %s", operation, primary.ID, locked.Reason), "WARN")
+		return locked
+	}
+
+	if bypass && service.CheckLocks(copies, false, time.Now()) != nil {
+		h.Audit.LogEvent("RETENTION_BYPASS", fmt.Sprintf("%s of file %s bypassed governance retention", operation, primary.ID), "WARN")
+	}
+	return nil
+}
+
+func lockedJSON(c *fiber.Ctx, fileID uuid.UUID, locked *service.LockedError) error {
+	return c.Status(423).JSON(fiber.Map{"error": "File is locked", "file_id": fileID, "details": locked.Reason})
+}
@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/google/uuid"
+)
+
+func TestGovernanceBypassNeedsPermission(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", func(b *model.Bucket) {
+		b.RetentionMode = service.RetentionGovernance
+		b.RetentionDays = 30
+	})
+	writer := env.issue(tn.App, model.ApiCredential{Permissions: []string{model.PermissionWrite, model.PermissionDelete}})
+	officer := env.issue(tn.App, model.ApiCredential{Permissions: []string{model.PermissionDelete, model.PermissionBypassRetention}})
+
+	fileID := env.upload(tn, "retained.txt", []byte("retained"))
+	path := "/api/v1/storage/files/" + fileID.String()
+	bypass := map[string]string{"X-Bypass-Governance-Retention": "true"}
+
+	decode(t, env.request(writer, http.MethodDelete, path, nil, nil), http.StatusLocked, nil)
+
+	for name, credential := range map[string]model.ApiCredential{"write and delete": writer, "unscoped": tn.Credential} {
+		t.Run(name, func(t *testing.T) {
+			decode(t, env.request(credential, http.MethodDelete, path, nil, bypass), http.StatusForbidden, nil)
+
+			retention := `{"mode":"GOVERNANCE","retain_until":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+			headers := map[string]string{"Content-Type": "application/json", "X-Bypass-Governance-Retention": "true"}
+			decode(t, env.request(credential, http.MethodPut, path+"/retention", []byte(retention), headers), http.StatusForbidden, nil)
+		})
+	}
+
+	decode(t, env.request(officer, http.MethodDelete, path, nil, bypass), http.StatusNoContent, nil)
+}
+
+func TestLegalHoldNeedsPermission(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	writer := env.issue(tn.App, model.ApiCredential{Permissions: []string{model.PermissionWrite}})
+	officer := env.issue(tn.App, model.ApiCredential{Permissions: []string{model.PermissionLegalHold}})
+
+	fileID := env.upload(tn, "held.txt", []byte("held"))
+	path := "/api/v1/storage/files/" + fileID.String() + "/legal-hold"
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	decode(t, env.request(officer, http.MethodPut, path, []byte(`{"hold":true}`), headers), http.StatusOK, nil)
+
+	for name, credential := range map[string]model.ApiCredential{"write": writer, "unscoped": tn.Credential} {
+		t.Run(name, func(t *testing.T) {
+			decode(t, env.request(credential, http.MethodPut, path, []byte(`{"hold":false}`), headers), http.StatusForbidden, nil)
+		})
+	}
+
+	var meta model.FileMetadata
+	env.DB.First(&meta, "id = ?", fileID)
+	if !meta.LegalHold {
+		t.Fatal("legal hold was released without the legal_hold permission")
+	}
+
+	decode(t, env.request(officer, http.MethodPut, path, []byte(`{"hold":false}`), headers), http.StatusOK, nil)
+}
+
+func TestRetentionChangeChecksEveryCopy(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	officer := env.issue(tn.App, model.ApiCredential{Permissions: []string{model.PermissionWrite, model.PermissionBypassRetention}})
+
+	fileID := env.upload(tn, "scan.dcm", []byte("scan"))
+	primaryUntil := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	replicaUntil := primaryUntil.Add(30 * 24 * time.Hour)
+	env.DB.Model(&model.FileMetadata{}).Where("id = ?", fileID).
+		Updates(map[string]interface{}{"retention_mode": service.RetentionGovernance, "retain_until": primaryUntil})
+
+	replica := model.FileMetadata{ID: uuid.New(), AppID: tn.App.ID, BucketID: tn.Bucket.ID, OriginalName: "scan.dcm",
+		PhysicalPath: "replica", ReplicaOf: &fileID, Version: 1, RetentionMode: service.RetentionCompliance, RetainUntil: &replicaUntil}
+	env.DB.Create(&replica)
+
+	// Extends the primary, but would shorten and downgrade the replica
+	path := "/api/v1/storage/files/" + fileID.String() + "/retention"
+	body := []byte(`{"mode":"GOVERNANCE","retain_until":"` + primaryUntil.Add(48*time.Hour).Format(time.RFC3339) + `"}`)
+	headers := map[string]string{"Content-Type": "application/json"}
+	decode(t, env.request(tn.Credential, http.MethodPut, path, body, headers), http.StatusLocked, nil)
+
+	headers["X-Bypass-Governance-Retention"] = "true"
+	decode(t, env.request(officer, http.MethodPut, path, body, headers), http.StatusLocked, nil)
+
+	var stored model.FileMetadata
+	env.DB.First(&stored, "id = ?", replica.ID)
+	if stored.RetentionMode != service.RetentionCompliance || !stored.RetainUntil.Equal(replicaUntil) {
+		t.Fatalf("replica retention changed to %s until %v", stored.RetentionMode, stored.RetainUntil)
+	}
+
+	// A governance replica can be shortened with the bypass permission
+	env.DB.Model(&model.FileMetadata{}).Where("id = ?", replica.ID).Update("retention_mode", service.RetentionGovernance)
+	delete(headers, "X-Bypass-Governance-Retention")
+	decode(t, env.request(officer, http.MethodPut, path, body, headers), http.StatusLocked, nil)
+	headers["X-Bypass-Governance-Retention"] = "true"
+	decode(t, env.request(officer, http.MethodPut, path, body, headers), http.StatusOK, nil)
+
+	env.DB.First(&stored, "id = ?", replica.ID)
+	if !stored.RetainUntil.Equal(primaryUntil.Add(48 * time.Hour)) {
+		t.Fatalf("replica retain_until = %v after the bypassed change", stored.RetainUntil)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// credential returns the API credential that authenticated the request.
+func credential(c *fiber.Ctx) model.ApiCredential {
+	credential, _ := c.Locals("credential").(model.ApiCredential)
+	return credential
+}
+
+// checkScope reports whether the caller's credential is missing permission or
+// access to bucket, auditing the refusal.
+func (h *StorageHandler) checkScope(c *fiber.Ctx, permission string, bucket model.Bucket) bool {
+	cred := credential(c)
+	if cred.Can(permission) && cred.AllowsBucket(bucket.Name) {
+		return false
+	}
+
+	h.Audit.LogEvent("CREDENTIAL_SCOPE_DENIED",
+		fmt.Sprintf("%s %s with credential %s: no %s access to bucket %s", c.Method(), c.Path(), cred.ApiKey, permission, bucket.Name), "WARN")
+	return true
+}
+
+func scopeJSON(c *fiber.Ctx, permission string, bucket model.Bucket) error {
+	return c.Status(403).JSON(fiber.Map{"error": scopeMessage(permission, bucket)})
+}
+
+func scopeMessage(permission string, bucket model.Bucket) string {
+	return fmt.Sprintf("Credential not allowed to %s in bucket %s", permission, bucket.Name)
+}
+
+// listableBuckets resolves the buckets a listing may cover: the one named in
+// ?bucket=, or every bucket of the app the credential may list.
+func (h *StorageHandler) listableBuckets(c *fiber.Ctx, appID uuid.UUID) ([]uuid.UUID, *fiber.Error) {
+	if name := c.Query("bucket"); name != "" {
+		var bucket model.Bucket
+		if err := h.DB.Where("app_id = ? AND name = ?", appID, name).First(&bucket).Error; err != nil {
+			return nil, fiber.NewError(404, "Bucket not found or access denied")
+		}
+		if h.checkScope(c, model.PermissionList, bucket) {
+			return nil, fiber.NewError(403, scopeMessage(model.PermissionList, bucket))
+		}
+		return []uuid.UUID{bucket.ID}, nil
+	}
+
+	cred := credential(c)
+	if !cred.Can(model.PermissionList) {
+		h.Audit.LogEvent("CREDENTIAL_SCOPE_DENIED",
+			fmt.Sprintf("%s %s with credential %s: no list permission", c.Method(), c.Path(), cred.ApiKey), "WARN")
+		return nil, fiber.NewError(403, "Credential not allowed to list")
+	}
+
+	var buckets []model.Bucket
+	h.DB.Where("app_id = ?", appID).Find(&buckets)
+
+	ids := make([]uuid.UUID, 0, len(buckets))
+	for _, bucket := range buckets {
+		if cred.AllowsBucket(bucket.Name) {
+			ids = append(ids, bucket.ID)
+		}
+	}
+	return ids, nil
+}
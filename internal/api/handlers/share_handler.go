@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultShareTTL = time.Hour
+	// maxLinkTTL bounds share links and presigned URLs (SigV4's own limit)
+	maxLinkTTL = 7 * 24 * time.Hour
+)
+
+type shareRequest struct {
+	ExpiresIn    string `json:"expires_in"` // Go duration ("15m") or seconds; 1h by default
+	MaxDownloads int    `json:"max_downloads"`
+	AllowedIP    string `json:"allowed_ip"`  // IP or CIDR
+	Disposition  string `json:"disposition"` // inline or attachment (default)
+}
+
+// CreateShare (POST /api/v1/storage/files/:id/share) mints a signed URL that
+// downloads the file without credentials until it expires.
+func (h *StorageHandler) CreateShare(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var req shareRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	baseURL, err := shareBaseURL()
+	if err != nil {
+		return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ttl := defaultShareTTL
+	if req.ExpiresIn != "" {
+		if ttl, err = parseLinkTTL(req.ExpiresIn); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if req.MaxDownloads < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "max_downloads cannot be negative"})
+	}
+	if !service.ValidAllowedIP(req.AllowedIP) {
+		return c.Status(400).JSON(fiber.Map{"error": "allowed_ip must be an IP address or CIDR"})
+	}
+	switch req.Disposition {
+	case "":
+		req.Disposition = service.DispositionAttachment
+	case service.DispositionInline, service.DispositionAttachment:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "disposition must be inline or attachment"})
+	}
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", c.Params("id"), appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+
+	// A link never outlives the file it points to
+	expiresAt := time.Now().Add(ttl)
+	if meta.ExpiresAt != nil && meta.ExpiresAt.Before(expiresAt) {
+		expiresAt = *meta.ExpiresAt
+	}
+
+	credentialID, _ := c.Locals("credential_id").(uuid.UUID)
+	link := model.ShareLink{
+		FileID:       meta.ID,
+		AppID:        appID,
+		CredentialID: credentialID,
+		ExpiresAt:    expiresAt,
+		MaxDownloads: req.MaxDownloads,
+		AllowedIP:    req.AllowedIP,
+		Disposition:  req.Disposition,
+	}
+	token, err := h.Shares.Create(&link)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create share link", "details": err.Error()})
+	}
+
+	h.Audit.LogEvent("FILE_SHARE_CREATE",
+		fmt.Sprintf("Share link %s for file %s created by app %s (expires %s, max downloads %d, ip %q)",
+			link.ID, meta.ID, appID, expiresAt.UTC().Format(time.RFC3339), link.MaxDownloads, link.AllowedIP), "WARN")
+
+	return c.Status(201).JSON(fiber.Map{
+		"id":            link.ID,
+		"url":           baseURL + "/api/v1/storage/share/" + token,
+		"token":         token,
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+		"allowed_ip":    link.AllowedIP,
+		"disposition":   link.Disposition,
+	})
+}
+
+// OpenShare (GET /api/v1/storage/share/:token) is public: the signed token is
+// the only credential. Every attempt is audited.
+func (h *StorageHandler) OpenShare(c *fiber.Ctx) error {
+	link, err := h.Shares.Open(c.Params("token"), c.IP(), time.Now())
+	if err != nil {
+		h.Audit.LogEvent("FILE_SHARE_DENIED",
+			fmt.Sprintf("Share link %s for file %s from %s refused: %v", link.ID, link.FileID, c.IP(), err), "WARN")
+
+		switch {
+		case errors.Is(err, service.ErrShareExpired), errors.Is(err, service.ErrShareExhausted), errors.Is(err, service.ErrShareRevoked):
+			return c.Status(410).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrShareIP):
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(404).JSON(fiber.Map{"error": "Share link not found"})
+		}
+	}
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", link.FileID, link.AppID).First(&meta).Error; err != nil {
+		h.Audit.LogEvent("FILE_SHARE_DENIED",
+			fmt.Sprintf("Share link %s from %s refused: file %s no longer exists", link.ID, c.IP(), link.FileID), "WARN")
+		return c.Status(404).JSON(fiber.Map{"error": "Share link not found"})
+	}
+
+	h.touch(meta.ID)
+	h.Audit.LogEvent("FILE_SHARE_ACCESS",
+		fmt.Sprintf("File %s downloaded through share link %s from %s (%d/%d)", meta.ID, link.ID, c.IP(), link.Downloads, link.MaxDownloads), "INFO")
+
+	c.Set("Cache-Control", "private, no-store")
+	return h.sendFile(c, meta, link.Disposition)
+}
+
+func parseLinkTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, errors.New("expires_in must be a duration such as \"15m\" or a number of seconds")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxLinkTTL {
+		return 0, fmt.Errorf("expires_in must be between 1s and %s", maxLinkTTL)
+	}
+	return ttl, nil
+}
+
+// shareBaseURL is SHARE_BASE_URL without its trailing slash. The request's
+// Host header is never used: a client could point the URL at any host.
+func shareBaseURL() (string, error) {
+	base := strings.TrimSuffix(os.Getenv("SHARE_BASE_URL"), "/")
+	if base == "" {
+		return "", errors.New("share links are disabled: SHARE_BASE_URL is not set")
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", errors.New("share links are disabled: SHARE_BASE_URL must be an absolute http(s) URL")
+	}
+	return base, nil
+}
@@ -0,0 +1,134 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/google/uuid"
+)
+
+type shareResponse struct {
+	ID    uuid.UUID `json:"id"`
+	URL   string    `json:"url"`
+	Token string    `json:"token"`
+}
+
+func (e *testEnv) share(credential model.ApiCredential, fileID uuid.UUID, status int) shareResponse {
+	e.t.Helper()
+
+	var out shareResponse
+	resp := e.request(credential, http.MethodPost, "/api/v1/storage/files/"+fileID.String()+"/share", nil,
+		map[string]string{"Host": "attacker.example"})
+	if status != http.StatusCreated {
+		decode(e.t, resp, status, nil)
+		return out
+	}
+	decode(e.t, resp, status, &out)
+	return out
+}
+
+func TestShareLinkNeedsConfiguredBaseURL(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	fileID := env.upload(tn, "report.pdf", []byte("report"))
+
+	t.Setenv("SHARE_BASE_URL", "")
+	env.share(tn.Credential, fileID, http.StatusServiceUnavailable)
+
+	t.Setenv("SHARE_BASE_URL", "storage.example.org")
+	env.share(tn.Credential, fileID, http.StatusServiceUnavailable)
+
+	t.Setenv("SHARE_BASE_URL", "https://storage.example.org/")
+	link := env.share(tn.Credential, fileID, http.StatusCreated)
+	if want := "https://storage.example.org/api/v1/storage/share/" + link.Token; link.URL != want {
+		t.Fatalf("url = %q, want %q", link.URL, want)
+	}
+}
+
+func TestShareLinksDieWithTheirCredential(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	fileID := env.upload(tn, "report.pdf", []byte("report"))
+	open := func(link shareResponse) *http.Response {
+		return env.request(model.ApiCredential{}, http.MethodGet, "/api/v1/storage/share/"+link.Token, nil, nil)
+	}
+
+	viewer := env.issue(tn.App, model.ApiCredential{Label: "viewer"})
+	link := env.share(viewer, fileID, http.StatusCreated)
+	if got := readBody(t, open(link)); string(got) != "report" {
+		t.Fatalf("share link served %q", got)
+	}
+
+	t.Run("revoked in place", func(t *testing.T) {
+		other := env.share(tn.Credential, fileID, http.StatusCreated)
+		// A credential revoked without going through Revoke still kills its links
+		env.DB.Model(&model.ApiCredential{}).Where("id = ?", tn.Credential.ID).Update("revoked_at", time.Now())
+		decode(t, open(other), http.StatusGone, nil)
+	})
+
+	t.Run("revoked through the service", func(t *testing.T) {
+		if err := service.NewCredentialService(env.DB).Revoke(tn.App.ID, viewer.ID); err != nil {
+			t.Fatal(err)
+		}
+		var count int64
+		env.DB.Model(&model.ShareLink{}).Where("credential_id = ?", viewer.ID).Count(&count)
+		if count != 0 {
+			t.Fatalf("%d share links of the revoked credential remain", count)
+		}
+		decode(t, open(link), http.StatusNotFound, nil)
+	})
+
+	t.Run("revoked certificate", func(t *testing.T) {
+		certificate := model.ClientCertificate{ID: uuid.New(), AppID: tn.App.ID, Subject: "CN=gateway"}
+		env.DB.Create(&certificate)
+		certLink := model.ShareLink{FileID: fileID, AppID: tn.App.ID, CredentialID: certificate.ID, ExpiresAt: time.Now().Add(time.Hour), Disposition: "inline"}
+		token, err := service.NewShareService(env.DB).Create(&certLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := open(shareResponse{Token: token}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("certificate link: status %d, want 200", resp.StatusCode)
+		}
+
+		if err := service.NewCredentialService(env.DB).RevokeCertificate(tn.App.ID, certificate.ID); err != nil {
+			t.Fatal(err)
+		}
+		resp := open(shareResponse{Token: token})
+		if body := readBody(t, resp); resp.StatusCode != http.StatusNotFound || strings.Contains(string(body), "report") {
+			t.Fatalf("link of a revoked certificate: status %d, body %s", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestShareLinkOfTrashedFileKeepsItsDownloads(t *testing.T) {
+	env := newTestEnv(t)
+	tn := env.newTenant("app-a", nil)
+	fileID := env.upload(tn, "report.pdf", []byte("report"))
+	link := env.share(tn.Credential, fileID, http.StatusCreated)
+	open := func() *http.Response {
+		return env.request(model.ApiCredential{}, http.MethodGet, "/api/v1/storage/share/"+link.Token, nil, nil)
+	}
+	downloads := func() int {
+		var stored model.ShareLink
+		env.DB.First(&stored, "id = ?", link.ID)
+		return stored.Downloads
+	}
+
+	env.DB.Model(&model.FileMetadata{}).Where("id = ?", fileID).Update("deleted_at", time.Now())
+	decode(t, open(), http.StatusNotFound, nil)
+	if got := downloads(); got != 0 {
+		t.Fatalf("downloads = %d after opening a link to a trashed file, want 0", got)
+	}
+
+	env.DB.Unscoped().Model(&model.FileMetadata{}).Where("id = ?", fileID).Update("deleted_at", nil)
+	if got := readBody(t, open()); string(got) != "report" {
+		t.Fatalf("share link served %q", got)
+	}
+	if got := downloads(); got != 1 {
+		t.Fatalf("downloads = %d after one download, want 1", got)
+	}
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
+	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/JAreyes98/healthconnect-storage-service/storage"
@@ -17,14 +21,22 @@ import (
 )
 
 type StorageHandler struct {
-	DB    *gorm.DB
-	Audit *service.AuditService
+	DB      *gorm.DB
+	Audit   *service.AuditService
+	Blobs   *service.BlobService
+	Usage   *service.UsageService
+	Shares  *service.ShareService
+	Presign *service.PresignService
 }
 
 func NewStorageHandler(db *gorm.DB, audit *service.AuditService) *StorageHandler {
 	return &StorageHandler{
-		DB:    db,
-		Audit: audit,
+		DB:      db,
+		Audit:   audit,
+		Blobs:   service.NewBlobService(db),
+		Usage:   service.NewUsageService(db),
+		Shares:  service.NewShareService(db),
+		Presign: service.NewPresignService(db),
 	}
 }
 
@@ -38,10 +50,17 @@ func (h *StorageHandler) UploadFile(c *fiber.Ctx) error {
 	if err := h.DB.Where("app_id = ? AND name = ?", appID, bucketName).First(&sourceBucket).Error; err != nil {
 		return c.Status(403).JSON(fiber.Map{"error": "Bucket not found or access denied"})
 	}
+	if h.checkScope(c, model.PermissionWrite, sourceBucket) {
+		return scopeJSON(c, model.PermissionWrite, sourceBucket)
+	}
+
+	expiresAt, err := parseExpiry(c, sourceBucket, time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	// 2. Read file content once to allow multiple uploads (replication)
 	var fileData []byte
-	var err error
 	stream := c.Context().RequestBodyStream()
 	if stream != nil {
 		fileData, err = io.ReadAll(stream)
@@ -57,10 +76,11 @@ func (h *StorageHandler) UploadFile(c *fiber.Ctx) error {
 	fileID := uuid.New()
 	ext := filepath.Ext(originalName)
 	physicalName := fileID.String() + ext
+	contentType := detectContentType(originalName, fileData)
 
 	// 4. Find Replication Rules
 	var rules []model.ReplicationRule
-	h.DB.Preload("TargetBucket").Where("source_bucket_id = ?", sourceBucket.ID).Find(&rules)
+	h.DB.Preload("TargetBucket").Where("source_bucket_id = ? AND app_id = ?", sourceBucket.ID, appID).Find(&rules)
 
 	// 5. Upload to Primary Bucket and Replicas
 	// We'll collect all target buckets (Source + Replicas)
@@ -71,20 +91,34 @@ func (h *StorageHandler) UploadFile(c *fiber.Ctx) error {
 
 	targets := []uploadTarget{{Bucket: sourceBucket, IsPrimary: true}}
 	for _, r := range rules {
+		// Files never leave their application, whatever an older rule says
+		if r.TargetBucket.AppID != appID {
+			h.Audit.LogEvent("REPLICATION_REFUSED",
+				fmt.Sprintf("Rule %s targets bucket %s of another application", r.ID, r.TargetBucket.Name), "ERROR")
+			continue
+		}
 		targets = append(targets, uploadTarget{Bucket: r.TargetBucket, IsPrimary: false})
 	}
 
-	for _, target := range targets {
-		strat, ok := storage.GetStrategy(target.Bucket.ProviderType)
+	fileSize := int64(len(fileData))
 
-		if !ok {
-			return c.Status(500).JSON(fiber.Map{"error": "Invalid storage provider"})
+	for _, target := range targets {
+		// Quotas are reserved before writing; a full replica bucket only skips that replica
+		if err := h.Usage.Reserve(target.Bucket, fileSize, 1); err != nil {
+			h.Audit.LogEvent("QUOTA_EXCEEDED",
+				fmt.Sprintf("Upload of %s to bucket %s refused: %v", originalName, target.Bucket.Name, err), "WARN")
+			if target.IsPrimary {
+				return quotaJSON(c, err)
+			}
+			continue
 		}
-		// Note: each target might have its own Cipher setting
-		path, err := strat.Upload(bytes.NewReader(fileData), physicalName, target.Bucket.Config, target.Bucket.Cipher)
+
+		// Note: each target might have its own Cipher and Dedup setting
+		stored, err := h.Blobs.Put(target.Bucket, fileData, physicalName, contentType)
 
 		if err != nil {
-			fmt.Sprintf("Failed to upload to bucket %s: %v", target.Bucket.Name, err.Error())
+			h.Usage.Add(target.Bucket.ID, target.Bucket.AppID, -fileSize, -1)
+			log.Printf("Failed to upload to bucket %s: %v", target.Bucket.Name, err)
 			h.Audit.LogEvent("REPLICATION_ERROR",
 				fmt.Sprintf("Failed to upload to bucket %s: %v", target.Bucket.Name, err), "ERROR")
 			if target.IsPrimary {
@@ -92,18 +126,34 @@ func (h *StorageHandler) UploadFile(c *fiber.Ctx) error {
 			}
 			continue // Skip failed replica, but keep going
 		}
-		fmt.Sprintf("Generating filemetadata on bucket %s", target.Bucket.Name)
+		log.Printf("Generating filemetadata on bucket %s", target.Bucket.Name)
 
 		// 6. Save Metadata for each successful upload
+		retentionMode, retainUntil := service.DefaultRetention(target.Bucket, time.Now())
 		fileMeta := model.FileMetadata{
-			ID:           uuid.New(), // Each entry gets its own ID if you want to track them separately
-			AppID:        appID,
-			BucketID:     target.Bucket.ID,
-			OriginalName: originalName,
-			PhysicalPath: path,
-			FileSize:     int64(len(fileData)),
+			ID:            fileID,
+			AppID:         appID,
+			BucketID:      target.Bucket.ID,
+			OriginalName:  originalName,
+			PhysicalPath:  stored.Path,
+			FileSize:      fileSize,
+			StoredSize:    stored.StoredSize,
+			ContentType:   contentType,
+			Compression:   stored.Compression,
+			ContentHash:   stored.Hash,
+			Version:       1,
+			RetentionMode: retentionMode,
+			RetainUntil:   retainUntil,
+			ExpiresAt:     expiresAt,
+		}
+		if !target.IsPrimary {
+			// Replicas get their own row, linked back to the primary file
+			fileMeta.ID = uuid.New()
+			fileMeta.ReplicaOf = &fileID
+		}
+		if err := h.DB.Create(&fileMeta).Error; err == nil {
+			h.Usage.Record(service.FileUsage(fileMeta, 1))
 		}
-		h.DB.Create(&fileMeta)
 	}
 
 	h.Audit.LogEvent("FILE_UPLOAD", fmt.Sprintf("File %s processed. Replicas created: %d", originalName, len(rules)), "INFO")
@@ -115,28 +165,24 @@ func (h *StorageHandler) UploadFile(c *fiber.Ctx) error {
 	})
 }
 
+// ViewFile (GET /api/v1/storage/files/view/:id) returns a file inline, e.g.
+// for previews in the browser.
 func (h *StorageHandler) ViewFile(c *fiber.Ctx) error {
 	fileID := c.Params("id")
-	var file model.FileMetadata
-
-	if err := h.DB.Preload("Bucket").First(&file, "id = ?", fileID).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
-	}
+	appID := c.Locals("app_id").(uuid.UUID)
 
-	strategy, ok := storage.GetStrategy(file.Bucket.ProviderType)
-	if !ok {
-		return c.Status(500).JSON(fiber.Map{"error": "Invalid storage provider"})
+	var file model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", fileID, appID).First(&file).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
 	}
-
-	reader, err := strategy.Download(file.PhysicalPath, file.Bucket.Config)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	if h.checkScope(c, model.PermissionRead, file.Bucket) {
+		return scopeJSON(c, model.PermissionRead, file.Bucket)
 	}
-	defer reader.Close()
 
 	// Read the entire content to avoid socket hang up during streaming
-	fileBytes, err := io.ReadAll(reader)
+	fileBytes, err := h.Blobs.Read(file.Bucket, file.PhysicalPath, file.Compression)
 	if err != nil {
+		h.Audit.LogEvent("DECRYPTION_FAILED", fmt.Sprintf("Critical: Failed to restore file %s: %v", file.ID, err), "ERROR")
 		return c.Status(500).JSON(fiber.Map{"error": "Error reading file content"})
 	}
 
@@ -145,6 +191,9 @@ func (h *StorageHandler) ViewFile(c *fiber.Ctx) error {
 		contentType = "application/octet-stream"
 	}
 
+	h.touch(file.ID)
+	h.Audit.LogEvent("FILE_VIEW", fmt.Sprintf("Viewing file ID: %s", file.ID), "INFO")
+
 	c.Set("Content-Disposition", "inline; filename=\""+file.OriginalName+"\"")
 	c.Set("Content-Type", contentType)
 
@@ -156,10 +205,13 @@ func (h *StorageHandler) GetMetadata(c *fiber.Ctx) error {
 	appID := c.Locals("app_id").(uuid.UUID)
 
 	var meta model.FileMetadata
-	if err := h.DB.Where("id = ? AND app_id = ?", id, appID).First(&meta).Error; err != nil {
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", id, appID).First(&meta).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Metadata no encontrada"})
 	}
-	return c.JSON(meta)
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+	return c.JSON(newFileView(meta))
 }
 
 func (h *StorageHandler) DownloadFile(c *fiber.Ctx) error {
@@ -172,6 +224,36 @@ func (h *StorageHandler) DownloadFile(c *fiber.Ctx) error {
 	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ?", fileID, appID).First(&meta).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
 	}
+	if h.checkScope(c, model.PermissionRead, meta.Bucket) {
+		return scopeJSON(c, model.PermissionRead, meta.Bucket)
+	}
+
+	h.touch(meta.ID)
+
+	return h.sendFile(c, meta, "attachment")
+}
+
+// sendFile writes a file's content with the given Content-Disposition. Files
+// that are encrypted or compressed are restored in memory; others are
+// streamed from the provider.
+func (h *StorageHandler) sendFile(c *fiber.Ctx, meta model.FileMetadata, disposition string) error {
+	contentType := mime.TypeByExtension(filepath.Ext(meta.OriginalName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Encrypted or compressed objects must be fully read to be restored
+	if meta.Bucket.Cipher || meta.Compression != "" {
+		data, err := h.Blobs.Read(meta.Bucket, meta.PhysicalPath, meta.Compression)
+		if err != nil {
+			h.Audit.LogEvent("DECRYPTION_FAILED", fmt.Sprintf("Critical: Failed to restore file %s: %v", meta.ID, err), "ERROR")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to decrypt file"})
+		}
+
+		c.Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, meta.OriginalName))
+		c.Set("Content-Type", contentType)
+		return c.Send(data)
+	}
 
 	strategy, ok := storage.GetStrategy(meta.Bucket.ProviderType)
 	if !ok {
@@ -182,32 +264,205 @@ func (h *StorageHandler) DownloadFile(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not retrieve file from storage"})
 	}
-	defer reader.Close()
 
-	contentType := mime.TypeByExtension(filepath.Ext(meta.OriginalName))
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	c.Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, meta.OriginalName))
+	c.Set("Content-Type", contentType)
+
+	// SendStream closes the reader once the body has been written
+	return c.SendStream(reader)
+}
+
+// touch records a read for LAST_ACCESS lifecycle rules. UpdateColumn keeps
+// updated_at untouched, so reads do not look like writes.
+func (h *StorageHandler) touch(fileID uuid.UUID) {
+	h.DB.Model(&model.FileMetadata{}).Where("id = ?", fileID).UpdateColumn("last_accessed_at", time.Now())
+}
+
+// DeleteFile (DELETE /api/v1/storage/files/:id) moves a file and its replicas
+// to the trash. They are physically removed by the TrashService once the
+// bucket's trash retention has passed, unless restored first.
+func (h *StorageHandler) DeleteFile(c *fiber.Ctx) error {
+	fileID := c.Params("id")
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	if err := h.DB.Preload("Bucket").Where("id = ? AND app_id = ? AND replica_of IS NULL", fileID, appID).First(&meta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found or access denied"})
+	}
+	if h.checkScope(c, model.PermissionDelete, meta.Bucket) {
+		return scopeJSON(c, model.PermissionDelete, meta.Bucket)
 	}
 
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", meta.OriginalName))
-	c.Set("Content-Type", contentType)
+	if h.checkBypass(c, meta.Bucket) {
+		return scopeJSON(c, model.PermissionBypassRetention, meta.Bucket)
+	}
+	if locked := h.checkLocks(c, meta, "Delete"); locked != nil {
+		return lockedJSON(c, meta.ID, locked)
+	}
+
+	result := h.DB.Where("(id = ? OR replica_of = ?) AND app_id = ?", meta.ID, meta.ID, meta.AppID).Delete(&model.FileMetadata{})
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete file"})
+	}
+
+	h.Audit.LogEvent("FILE_DELETE", fmt.Sprintf("File %s moved to trash (%d copies)", meta.ID, result.RowsAffected), "INFO")
+
+	return c.SendStatus(204)
+}
+
+// ListFiles (GET /api/v1/storage/files?bucket=name&prefix=&limit=&offset=)
+// lists the caller's files, newest first, in the buckets its credential may
+// list.
+func (h *StorageHandler) ListFiles(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	bucketIDs, ferr := h.listableBuckets(c, appID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := h.DB.Model(&model.FileMetadata{}).
+		Where("app_id = ? AND replica_of IS NULL AND bucket_id IN ?", appID, bucketIDs)
+	if prefix := c.Query("prefix"); prefix != "" {
+		query = query.Where("original_name LIKE ?", escapeLike(prefix)+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var files []model.FileMetadata
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&files).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch files"})
+	}
+
+	return c.JSON(fiber.Map{"files": newFileViews(files), "total": total, "limit": limit, "offset": offset})
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ListTrash (GET /api/v1/storage/files/trash?bucket=name) lists the caller's
+// deleted files that can still be restored.
+func (h *StorageHandler) ListTrash(c *fiber.Ctx) error {
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	query := h.DB.Unscoped().
+		Where("file_metadata.app_id = ? AND file_metadata.deleted_at IS NOT NULL AND file_metadata.replica_of IS NULL", appID)
+
+	bucketIDs, ferr := h.listableBuckets(c, appID)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
+	query = query.Where("file_metadata.bucket_id IN ?", bucketIDs)
+
+	var files []model.FileMetadata
+	if err := query.Order("deleted_at DESC").Find(&files).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch trash"})
+	}
 
-	if meta.Bucket.Cipher {
-		encryptedData, err := io.ReadAll(reader)
+	return c.JSON(newFileViews(files))
+}
+
+// RestoreFile (POST /api/v1/storage/files/:id/restore) takes a file and its
+// replicas back out of the trash.
+func (h *StorageHandler) RestoreFile(c *fiber.Ctx) error {
+	fileID := c.Params("id")
+	appID := c.Locals("app_id").(uuid.UUID)
+
+	var meta model.FileMetadata
+	err := h.DB.Unscoped().Preload("Bucket").
+		Where("id = ? AND app_id = ? AND replica_of IS NULL AND deleted_at IS NOT NULL", fileID, appID).
+		First(&meta).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found in trash"})
+	}
+	if h.checkScope(c, model.PermissionWrite, meta.Bucket) {
+		return scopeJSON(c, model.PermissionWrite, meta.Bucket)
+	}
+
+	err = h.DB.Unscoped().Model(&model.FileMetadata{}).
+		Where("(id = ? OR replica_of = ?) AND app_id = ?", meta.ID, meta.ID, meta.AppID).
+		Update("deleted_at", nil).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not restore file"})
+	}
+
+	h.Audit.LogEvent("FILE_RESTORE", fmt.Sprintf("File %s restored from trash", meta.ID), "INFO")
+
+	return c.JSON(fiber.Map{"message": "File restored", "file_id": meta.ID})
+}
+
+// parseExpiry reads the optional X-Expires-At (RFC 3339) or X-Expires-In
+// (Go duration such as "72h", or seconds) headers, falling back to the
+// bucket's default TTL. It returns nil when the file never expires.
+func parseExpiry(c *fiber.Ctx, bucket model.Bucket, now time.Time) (*time.Time, error) {
+	expiresAt := c.Get("X-Expires-At")
+	expiresIn := c.Get("X-Expires-In")
+
+	var at time.Time
+	switch {
+	case expiresAt != "" && expiresIn != "":
+		return nil, fmt.Errorf("use either X-Expires-At or X-Expires-In, not both")
+	case expiresAt != "":
+		parsed, err := time.Parse(time.RFC3339, expiresAt)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Error reading encrypted stream"})
+			return nil, fmt.Errorf("invalid X-Expires-At: expected RFC 3339 timestamp")
 		}
-
-		decryptedData, err := crypto.Decrypt(encryptedData)
+		at = parsed
+	case expiresIn != "":
+		ttl, err := time.ParseDuration(expiresIn)
 		if err != nil {
-			h.Audit.LogEvent("DECRYPTION_FAILED", fmt.Sprintf("Critical: Failed to decrypt file %s", fileID), "ERROR")
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to decrypt file"})
+			seconds, convErr := strconv.ParseInt(expiresIn, 10, 64)
+			if convErr != nil {
+				return nil, fmt.Errorf("invalid X-Expires-In: expected a duration like 72h or seconds")
+			}
+			ttl = time.Duration(seconds) * time.Second
 		}
+		at = now.Add(ttl)
+	case bucket.DefaultTTLHours > 0:
+		at = now.Add(time.Duration(bucket.DefaultTTLHours) * time.Hour)
+	default:
+		return nil, nil
+	}
 
-		return c.Send(decryptedData)
+	if !at.After(now) {
+		return nil, fmt.Errorf("expiry must be in the future")
 	}
+	return &at, nil
+}
 
-	return c.SendStream(reader)
+// quotaJSON answers a refused write: 413 when the file itself is too large,
+// 507 when the bucket or app is full.
+func quotaJSON(c *fiber.Ctx, err error) error {
+	var quota *service.QuotaError
+	if !errors.As(err, &quota) {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not check quota", "details": err.Error()})
+	}
+
+	status := fiber.StatusInsufficientStorage
+	if quota.TooLarge {
+		status = fiber.StatusRequestEntityTooLarge
+	}
+	return c.Status(status).JSON(fiber.Map{"error": "Quota exceeded", "scope": quota.Scope, "details": quota.Error()})
+}
+
+// detectContentType prefers the type implied by the original file name and
+// falls back to sniffing the first bytes.
+func detectContentType(originalName string, data []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(originalName)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
 }
 
 func (h *AdminHandler) GetBucketFiles(c *fiber.Ctx) error {
@@ -224,12 +479,6 @@ func (h *AdminHandler) GetBucketFiles(c *fiber.Ctx) error {
 	}
 
 	for i := range files {
-		var total int64
-		h.DB.Model(&model.FileMetadata{}).
-			Where("bucket_id = ?", files[i].ID).
-			Select("COALESCE(SUM(file_size), 0)").
-			Scan(&total)
-
 		files[i].IsCiphered = bucket.Cipher
 	}
 
@@ -0,0 +1,211 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/api/handlers"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// TestFileRoutesAreTenantIsolated calls every /files route with app A's
+// credential and app B's file and bucket.
+func TestFileRoutesAreTenantIsolated(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.newTenant("app-a", nil)
+	b := env.newTenant("app-b", nil)
+
+	ownFile := env.upload(a, "a.txt", []byte("file of app A"))
+	otherFile := env.upload(b, "b.txt", []byte("file of app B"))
+	trashedFile := env.upload(b, "trashed.txt", []byte("deleted file of app B"))
+	decode(t, env.request(b.Credential, http.MethodDelete, "/api/v1/storage/files/"+trashedFile.String(), nil, nil), http.StatusNoContent, nil)
+
+	pending := model.PendingUpload{ID: uuid.New(), AppID: b.App.ID, BucketID: b.Bucket.ID, OriginalName: "p.txt", Size: 1}
+	env.DB.Create(&pending)
+
+	files := "/api/v1/storage/files/"
+	other := otherFile.String()
+	jsonBody := map[string]string{"Content-Type": "application/json"}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{"view", http.MethodGet, files + "view/" + other, "", nil, 404},
+		{"download", http.MethodGet, files + "download/" + other, "", nil, 404},
+		{"metadata", http.MethodGet, files + other, "", nil, 404},
+		{"update", http.MethodPut, files + other, "new content", nil, 404},
+		{"delete", http.MethodDelete, files + other, "", nil, 404},
+		{"restore", http.MethodPost, files + trashedFile.String() + "/restore", "", nil, 404},
+		{"legal hold", http.MethodPut, files + other + "/legal-hold", `{"hold":true}`, jsonBody, 404},
+		{"retention", http.MethodPut, files + other + "/retention", `{"mode":"GOVERNANCE","retain_until":"2999-01-01T00:00:00Z"}`, jsonBody, 404},
+		{"versions", http.MethodGet, files + other + "/versions", "", nil, 404},
+		{"version download", http.MethodGet, files + other + "/versions/1", "", nil, 404},
+		{"version restore", http.MethodPost, files + other + "/versions/1/restore", "", nil, 404},
+		{"share", http.MethodPost, files + other + "/share", `{"expires_in":"1h"}`, jsonBody, 404},
+		{"presign download", http.MethodGet, files + other + "/presign", "", nil, 404},
+		{"complete direct upload", http.MethodPost, files + "uploads/" + pending.ID.String() + "/complete", "", nil, 404},
+		{"upload to other bucket", http.MethodPost, files + "upload", "data", map[string]string{"X-Bucket-Name": b.Bucket.Name, "X-Original-Filename": "x.txt"}, 403},
+		{"direct upload to other bucket", http.MethodPost, files + "uploads", `{"bucket":"` + b.Bucket.Name + `","filename":"x.txt","size":4}`, jsonBody, 403},
+		{"list other bucket", http.MethodGet, files + "?bucket=" + b.Bucket.Name, "", nil, 404},
+		{"trash of other bucket", http.MethodGet, files + "trash?bucket=" + b.Bucket.Name, "", nil, 404},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := env.request(a.Credential, tc.method, tc.path, []byte(tc.body), tc.headers)
+			decode(t, resp, tc.status, nil)
+		})
+	}
+
+	// Nothing of B changed: the file is intact and the trashed one still trashed
+	resp := env.request(b.Credential, http.MethodGet, files+"download/"+other, nil, nil)
+	if got := readBody(t, resp); string(got) != "file of app B" {
+		t.Fatalf("file of app B = %q after app A's requests", got)
+	}
+	var meta model.FileMetadata
+	env.DB.First(&meta, "id = ?", otherFile)
+	if meta.LegalHold || meta.RetentionMode != "" || meta.Version != 1 {
+		t.Fatalf("file of app B was modified: %+v", meta)
+	}
+	var restored int64
+	env.DB.Model(&model.FileMetadata{}).Where("id = ?", trashedFile).Count(&restored)
+	if restored != 0 {
+		t.Fatal("trashed file of app B was restored by app A")
+	}
+
+	// Listings only ever show the caller's files
+	var listing struct {
+		Files []struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"files"`
+	}
+	decode(t, env.request(a.Credential, http.MethodGet, files, nil, nil), 200, &listing)
+	if len(listing.Files) != 1 || listing.Files[0].ID != ownFile {
+		t.Fatalf("app A lists %+v, want only %s", listing.Files, ownFile)
+	}
+	var trash []struct {
+		ID uuid.UUID `json:"id"`
+	}
+	decode(t, env.request(a.Credential, http.MethodGet, files+"trash", nil, nil), 200, &trash)
+	if len(trash) != 0 {
+		t.Fatalf("app A sees trash of app B: %+v", trash)
+	}
+}
+
+func TestViewFileDecryptsCipherBucket(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.newTenant("app-a", func(b *model.Bucket) { b.Cipher = true })
+	b := env.newTenant("app-b", func(b *model.Bucket) { b.Cipher = true })
+
+	plaintext := []byte("patient record: confidential")
+	fileID := env.upload(a, "record.txt", plaintext)
+
+	var meta model.FileMetadata
+	env.DB.Preload("Bucket").First(&meta, "id = ?", fileID)
+	var cfg storage.MemoryConfig
+	json.Unmarshal([]byte(meta.Bucket.Config), &cfg)
+	stored, ok := storage.MemoryNamespace(cfg.Namespace).Object(meta.PhysicalPath)
+	if !ok {
+		t.Fatal("uploaded object not found in the memory store")
+	}
+	if bytes.Contains(stored, plaintext) {
+		t.Fatal("cipher bucket stored the plaintext")
+	}
+
+	resp := env.request(a.Credential, http.MethodGet, "/api/v1/storage/files/view/"+fileID.String(), nil, nil)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := readBody(t, resp); !bytes.Equal(got, plaintext) {
+		t.Fatalf("view = %q, want %q", got, plaintext)
+	}
+
+	resp = env.request(b.Credential, http.MethodGet, "/api/v1/storage/files/view/"+fileID.String(), nil, nil)
+	decode(t, resp, 404, nil)
+}
+
+func TestReplicationRulesStayWithinApp(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.newTenant("app-a", nil)
+	b := env.newTenant("app-b", nil)
+
+	replica := model.Bucket{ID: uuid.New(), AppID: a.App.ID, Name: "app-a-replica", ProviderType: "MEMORY", Config: `{"namespace":"` + uuid.NewString() + `"}`}
+	env.DB.Create(&replica)
+
+	replicate := handlers.NewReplicationHandler(env.DB)
+	app := fiber.New()
+	app.Post("/replication", replicate.CreateRule)
+	app.Patch("/replication/:id/toggle", replicate.ToggleRule)
+
+	create := func(rule map[string]any) *http.Response {
+		body, _ := json.Marshal(rule)
+		req := httptest.NewRequest(http.MethodPost, "/replication", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("target in another app", func(t *testing.T) {
+		decode(t, create(map[string]any{"sourceBucketId": a.Bucket.ID, "targetBucketId": b.Bucket.ID}), 404, nil)
+	})
+	t.Run("appId of another app", func(t *testing.T) {
+		decode(t, create(map[string]any{"appId": b.App.ID, "sourceBucketId": a.Bucket.ID, "targetBucketId": replica.ID}), 400, nil)
+	})
+	t.Run("same app", func(t *testing.T) {
+		var rule model.ReplicationRule
+		decode(t, create(map[string]any{"sourceBucketId": a.Bucket.ID, "targetBucketId": replica.ID}), 201, &rule)
+		if rule.AppID != a.App.ID {
+			t.Fatalf("rule app = %s, want the source bucket's app %s", rule.AppID, a.App.ID)
+		}
+	})
+
+	t.Run("toggle cross-app rule", func(t *testing.T) {
+		legacy := model.ReplicationRule{ID: uuid.New(), AppID: a.App.ID, SourceBucketID: a.Bucket.ID, TargetBucketID: b.Bucket.ID}
+		env.DB.Create(&legacy)
+		env.DB.Model(&legacy).Update("active", false)
+
+		req := httptest.NewRequest(http.MethodPatch, "/replication/"+legacy.ID.String()+"/toggle", nil)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decode(t, resp, 409, nil)
+
+		var stored model.ReplicationRule
+		env.DB.First(&stored, "id = ?", legacy.ID)
+		if stored.Active {
+			t.Fatal("cross-app rule was activated")
+		}
+	})
+
+	t.Run("upload skips cross-app rule", func(t *testing.T) {
+		env.DB.Model(&model.ReplicationRule{}).Where("target_bucket_id = ?", b.Bucket.ID).Update("active", true)
+
+		fileID := env.upload(a, "replicated.txt", []byte("stays in app A"))
+
+		var copies []model.FileMetadata
+		env.DB.Where("id = ? OR replica_of = ?", fileID, fileID).Find(&copies)
+		for _, c := range copies {
+			if c.BucketID == b.Bucket.ID || c.AppID != a.App.ID {
+				t.Fatalf("file copied outside app A: %+v", c)
+			}
+		}
+		if len(copies) != 2 {
+			t.Fatalf("copies = %d, want the primary and the same-app replica", len(copies))
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/auth"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminAuth protects the admin API with bearer JWTs from the identity
+// provider. storage-admin may do anything; storage-auditor may only read.
+// Every request, allowed or not, is audited with the caller's identity.
+func AdminAuth(verifier *auth.Verifier, audit *service.AuditService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			audit.LogEvent("ADMIN_AUTH_FAILED", fmt.Sprintf("%s %s from %s: missing bearer token", c.Method(), c.Path(), c.IP()), "WARN")
+			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		identity, err := verifier.Verify(token)
+		if err != nil {
+			audit.LogEvent("ADMIN_AUTH_FAILED", fmt.Sprintf("%s %s from %s: %v", c.Method(), c.Path(), c.IP(), err), "WARN")
+			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		readOnly := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+		if !identity.HasRole(auth.RoleAdmin) && !(readOnly && identity.HasRole(auth.RoleAuditor)) {
+			audit.LogEvent("ADMIN_ACCESS_DENIED", fmt.Sprintf("%s %s by %s: missing role", c.Method(), c.Path(), identity), "WARN")
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+
+		c.Locals("admin_identity", identity)
+
+		err = c.Next()
+
+		audit.LogEvent("ADMIN_REQUEST",
+			fmt.Sprintf("%s %s by %s from %s: %d", c.Method(), c.Path(), identity, c.IP(), c.Response().StatusCode()), "INFO")
+		return err
+	}
+}
@@ -1,23 +1,73 @@
 package middleware
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/client"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 // internal/api/middleware/auth.go
-func StorageAuth(db *gorm.DB) fiber.Handler {
+func StorageAuth(db *gorm.DB, audit *service.AuditService) fiber.Handler {
+	credentials := service.NewCredentialService(db)
+	allowlist := newIPAllowlist(db)
+
+	maxSkew, err := time.ParseDuration(os.Getenv("HMAC_MAX_SKEW"))
+	if err != nil || maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	signed := newSignedAuth(credentials, maxSkew)
+
 	return func(c *fiber.Ctx) error {
-		apiKey := c.Get("X-API-Key")
-		apiSecret := c.Get("X-API-Secret")
+		var credential model.ApiCredential
+		var err error
 
-		var app model.App
-		if err := db.Where("api_key = ? AND api_secret = ?", apiKey, apiSecret).First(&app).Error; err != nil {
+		authorization := c.Get("Authorization")
+		switch {
+		// Signed requests (package client) never send the secret itself
+		case strings.HasPrefix(authorization, client.Algorithm+" "):
+			credential, err = signed.authenticate(c, authorization)
+		case c.Get("X-API-Key") != "":
+			credential, err = credentials.Authenticate(c.Get("X-API-Key"), c.Get("X-API-Secret"))
+		default:
+			// Certificado de cliente verificado por el TLS del servidor (mTLS)
+			credential, err = certificateCredential(c, credentials)
+		}
+		if err != nil {
 			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 		}
 
-		c.Locals("app_id", app.ID) // Guardamos el ID de la app para filtrar queries
+		allowed, err := allowlist.allows(credential.AppID, c.IP())
+		if err != nil {
+			audit.LogEvent("IP_ALLOWLIST_ERROR",
+				fmt.Sprintf("%s %s from %s refused for app %s: %v", c.Method(), c.Path(), c.IP(), credential.AppID, err), "ERROR")
+			return c.Status(503).JSON(fiber.Map{"error": "Client address could not be checked"})
+		}
+		if !allowed {
+			audit.LogEvent("IP_NOT_ALLOWED",
+				fmt.Sprintf("%s %s from %s refused for app %s (credential %s)", c.Method(), c.Path(), c.IP(), credential.AppID, credential.ApiKey), "WARN")
+			return c.Status(403).JSON(fiber.Map{"error": "Client address not allowed"})
+		}
+
+		c.Locals("app_id", credential.AppID) // Guardamos el ID de la app para filtrar queries
+		c.Locals("credential_id", credential.ID)
+		c.Locals("credential", credential) // buckets y permisos permitidos
 		return c.Next()
 	}
 }
+
+// certificateCredential authenticates with the client certificate of the
+// connection, which the TLS layer has already verified against the CA.
+func certificateCredential(c *fiber.Ctx, credentials *service.CredentialService) (model.ApiCredential, error) {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return model.ApiCredential{}, service.ErrInvalidCredential
+	}
+	return credentials.AuthenticateCertificate(state.VerifiedChains[0][0])
+}
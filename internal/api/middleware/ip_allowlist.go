@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type appNetworks struct {
+	networks []*net.IPNet
+	err      error // allowlist configured but unparsable
+	fetched  time.Time
+}
+
+// ipAllowlist checks client addresses against App.AllowedCIDRs, cached for
+// limitsTTL like the rate limits.
+type ipAllowlist struct {
+	db    *gorm.DB
+	mu    sync.Mutex
+	cache map[uuid.UUID]appNetworks
+}
+
+func newIPAllowlist(db *gorm.DB) *ipAllowlist {
+	return &ipAllowlist{db: db, cache: make(map[uuid.UUID]appNetworks)}
+}
+
+// allows reports whether ip may call the API for the app. Apps without an
+// allowlist accept any address. An allowlist that cannot be loaded or parsed
+// returns an error, and the caller must refuse the request.
+func (l *ipAllowlist) allows(appID uuid.UUID, ip string) (bool, error) {
+	networks, err := l.networks(appID)
+	if err != nil {
+		return false, err
+	}
+	if networks == nil {
+		return true, nil
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false, nil
+	}
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// networks returns the app's allowlist, or nil when it has none.
+func (l *ipAllowlist) networks(appID uuid.UUID) ([]*net.IPNet, error) {
+	l.mu.Lock()
+	cached, ok := l.cache[appID]
+	l.mu.Unlock()
+	if ok && time.Since(cached.fetched) < limitsTTL {
+		return cached.networks, cached.err
+	}
+
+	// Lookup failures are not cached, the next request tries again
+	var app model.App
+	if err := l.db.Select("id", "allowed_cidrs").First(&app, "id = ?", appID).Error; err != nil {
+		return nil, fmt.Errorf("loading allowlist of app %s: %w", appID, err)
+	}
+
+	entry := appNetworks{networks: parseNetworks(app.AllowedCIDRs), fetched: time.Now()}
+	if len(app.AllowedCIDRs) > 0 && len(entry.networks) != len(app.AllowedCIDRs) {
+		entry.networks = nil
+		entry.err = fmt.Errorf("allowlist of app %s has invalid entries: %v", appID, app.AllowedCIDRs)
+	}
+
+	l.mu.Lock()
+	l.cache[appID] = entry
+	l.mu.Unlock()
+	return entry.networks, entry.err
+}
+
+// parseNetworks parses CIDRs and single addresses, skipping invalid entries.
+func parseNetworks(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		// Single addresses are stored without a prefix length
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	db := newTestDB(t)
+
+	app := func(cidrs ...string) uuid.UUID {
+		a := model.App{ID: uuid.New(), AppName: uuid.NewString(), AllowedCIDRs: cidrs}
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		return a.ID
+	}
+	open := app()
+	restricted := app("10.0.0.0/8", "192.168.1.7", "2001:db8::/32")
+	broken := app("10.0.0.0/8", "not-a-network")
+
+	allowlist := newIPAllowlist(db)
+	cases := []struct {
+		name    string
+		app     uuid.UUID
+		ip      string
+		allowed bool
+		err     bool
+	}{
+		{"no allowlist", open, "203.0.113.9", true, false},
+		{"inside a network", restricted, "10.20.30.40", true, false},
+		{"single address", restricted, "192.168.1.7", true, false},
+		{"ipv6 network", restricted, "2001:db8::1", true, false},
+		{"outside", restricted, "192.168.1.8", false, false},
+		{"unparsable client address", restricted, "unknown", false, false},
+		{"invalid entry fails closed", broken, "10.0.0.1", false, true},
+		{"unknown app fails closed", uuid.New(), "10.0.0.1", false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			allowed, err := allowlist.allows(tc.app, tc.ip)
+			if allowed != tc.allowed || (err != nil) != tc.err {
+				t.Fatalf("allows(%s) = %t, %v; want %t, error %t", tc.ip, allowed, err, tc.allowed, tc.err)
+			}
+		})
+	}
+}
+
+func TestStorageAuthRefusesOnAllowlist(t *testing.T) {
+	db := newTestDB(t)
+	credentials := service.NewCredentialService(db)
+
+	request := func(cidrs []string) int {
+		a := model.App{ID: uuid.New(), AppName: uuid.NewString(), AllowedCIDRs: cidrs}
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		credential, err := credentials.Issue(db, model.ApiCredential{AppID: a.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app := fiber.New()
+		app.Get("/", StorageAuth(db, &service.AuditService{}), func(c *fiber.Ctx) error { return c.SendStatus(204) })
+
+		// app.Test connects from 0.0.0.0
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", credential.ApiKey)
+		req.Header.Set("X-API-Secret", credential.ApiSecret)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := request(nil); got != 204 {
+		t.Errorf("no allowlist: status %d, want 204", got)
+	}
+	if got := request([]string{"0.0.0.0/32"}); got != 204 {
+		t.Errorf("allowed address: status %d, want 204", got)
+	}
+	if got := request([]string{"10.0.0.0/8"}); got != 403 {
+		t.Errorf("other address: status %d, want 403", got)
+	}
+	if got := request([]string{"0.0.0.0/32", "10.0.0.0/33"}); got != 503 {
+		t.Errorf("invalid allowlist: status %d, want 503", got)
+	}
+}
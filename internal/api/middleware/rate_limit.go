@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/ratelimit"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// limitsTTL is how long an app's limits are cached, so changes apply
+	// within this delay
+	limitsTTL = 30 * time.Second
+	// deniedAuditInterval keeps a throttled app from flooding the audit log
+	deniedAuditInterval = time.Minute
+)
+
+type appLimits struct {
+	RequestsPerSecond    int
+	ConcurrentUploads    int
+	UploadBytesPerMinute int64
+	fetched              time.Time
+}
+
+// RateLimiter enforces the per-app limits configured on App. It runs after
+// StorageAuth, which provides the app_id. If the backend fails, requests are
+// let through rather than taking the service down with it.
+type RateLimiter struct {
+	DB      *gorm.DB
+	Backend ratelimit.Backend
+	Audit   *service.AuditService
+
+	mu     sync.Mutex
+	limits map[uuid.UUID]appLimits
+	denied map[uuid.UUID]time.Time
+}
+
+func NewRateLimiter(db *gorm.DB, backend ratelimit.Backend, audit *service.AuditService) *RateLimiter {
+	return &RateLimiter{
+		DB:      db,
+		Backend: backend,
+		Audit:   audit,
+		limits:  make(map[uuid.UUID]appLimits),
+		denied:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Requests limits requests per second.
+func (r *RateLimiter) Requests() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		appID, ok := c.Locals("app_id").(uuid.UUID)
+		if !ok {
+			return c.Next()
+		}
+
+		limits := r.appLimits(appID)
+		if limits.RequestsPerSecond <= 0 {
+			return c.Next()
+		}
+
+		rate := float64(limits.RequestsPerSecond)
+		decision, err := r.Backend.Take("rps:"+appID.String(), rate, rate, 1)
+		if err != nil {
+			log.Printf("Warning: rate limit backend failed: %v", err)
+			return c.Next()
+		}
+
+		if !decision.Allowed {
+			return r.tooMany(c, appID, "requests per second", decision, 1)
+		}
+		setRateLimitHeaders(c, decision, 1)
+		return c.Next()
+	}
+}
+
+// Uploads limits concurrent uploads and uploaded bytes per minute. It goes on
+// the routes that accept file content. The concurrency slot is taken first,
+// so uploads turned away for concurrency do not use up the byte budget. Fiber
+// has already read the body by then: the slot bounds the uploads being
+// stored, not the bodies being received.
+func (r *RateLimiter) Uploads() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		appID, ok := c.Locals("app_id").(uuid.UUID)
+		if !ok {
+			return c.Next()
+		}
+
+		limits := r.appLimits(appID)
+
+		if limits.ConcurrentUploads > 0 {
+			key := "uploads:" + appID.String()
+			acquired, err := r.Backend.Acquire(key, limits.ConcurrentUploads)
+			switch {
+			case err != nil:
+				log.Printf("Warning: rate limit backend failed: %v", err)
+			case !acquired:
+				return r.tooMany(c, appID, "concurrent uploads", ratelimit.Decision{
+					Limit:      int64(limits.ConcurrentUploads),
+					RetryAfter: time.Second,
+					Reset:      time.Second,
+				}, 1)
+			default:
+				defer func() {
+					if err := r.Backend.Release(key); err != nil {
+						log.Printf("Warning: rate limit backend failed: %v", err)
+					}
+				}()
+			}
+		}
+
+		if limits.UploadBytesPerMinute > 0 {
+			// A body larger than a whole minute's budget could never pass,
+			// so it is charged the full budget instead
+			size := float64(len(c.Request().Body()))
+			burst := float64(limits.UploadBytesPerMinute)
+			cost := min(size, burst)
+
+			decision, err := r.Backend.Take("bytes:"+appID.String(), burst/60, burst, cost)
+			if err != nil {
+				log.Printf("Warning: rate limit backend failed: %v", err)
+			} else if !decision.Allowed {
+				return r.tooMany(c, appID, "upload bytes per minute", decision, 60)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func (r *RateLimiter) appLimits(appID uuid.UUID) appLimits {
+	r.mu.Lock()
+	cached, ok := r.limits[appID]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < limitsTTL {
+		return cached
+	}
+
+	var limits appLimits
+	r.DB.Model(&model.App{}).
+		Select("requests_per_second, concurrent_uploads, upload_bytes_per_minute").
+		Where("id = ?", appID).
+		Scan(&limits)
+	limits.fetched = time.Now()
+
+	r.mu.Lock()
+	r.limits[appID] = limits
+	r.mu.Unlock()
+	return limits
+}
+
+// tooMany answers 429 with the RateLimit-* headers of the exceeded limit, whose
+// window is in seconds, and a Retry-After.
+func (r *RateLimiter) tooMany(c *fiber.Ctx, appID uuid.UUID, limit string, decision ratelimit.Decision, window int) error {
+	setRateLimitHeaders(c, decision, window)
+
+	retryAfter := int(decision.RetryAfter / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Set("Retry-After", strconv.Itoa(retryAfter))
+
+	r.mu.Lock()
+	audit := time.Since(r.denied[appID]) >= deniedAuditInterval
+	if audit {
+		r.denied[appID] = time.Now()
+	}
+	r.mu.Unlock()
+	if audit {
+		r.Audit.LogEvent("RATE_LIMITED", fmt.Sprintf("App %s exceeded its %s limit on %s %s", appID, limit, c.Method(), c.Path()), "WARN")
+	}
+
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Rate limit exceeded", "limit": limit, "retry_after": retryAfter})
+}
+
+// setRateLimitHeaders writes the RateLimit-* headers of the IETF draft, with
+// the policy window in seconds.
+func setRateLimitHeaders(c *fiber.Ctx, decision ratelimit.Decision, window int) {
+	c.Set("RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+	c.Set("RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+	c.Set("RateLimit-Reset", strconv.Itoa(int(decision.Reset/time.Second)))
+	c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", decision.Limit, window))
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/ratelimit"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestUploadsTakeTheSlotBeforeTheByteBudget(t *testing.T) {
+	db := newTestDB(t)
+	a := model.App{ID: uuid.New(), AppName: "uploader", ConcurrentUploads: 1, UploadBytesPerMinute: 600}
+	if err := db.Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	backend := ratelimit.NewMemoryBackend()
+	limiter := NewRateLimiter(db, backend, &service.AuditService{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("app_id", a.ID)
+		return c.Next()
+	})
+	app.Post("/upload", limiter.Uploads(), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusCreated) })
+
+	upload := func(size int) *http.Response {
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(make([]byte, size))), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expectHeaders := func(resp *http.Response) {
+		t.Helper()
+		for _, h := range []string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"} {
+			if resp.Header.Get(h) == "" {
+				t.Errorf("429 without %s", h)
+			}
+		}
+	}
+
+	// Another upload holds the only slot
+	key := "uploads:" + a.ID.String()
+	if ok, _ := backend.Acquire(key, 1); !ok {
+		t.Fatal("could not take the slot")
+	}
+	for i := 0; i < 3; i++ {
+		resp := upload(600)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("status = %d with the slot taken, want 429", resp.StatusCode)
+		}
+		expectHeaders(resp)
+		if got := resp.Header.Get("RateLimit-Limit"); got != "1" {
+			t.Fatalf("RateLimit-Limit = %s, want the concurrency limit", got)
+		}
+	}
+	backend.Release(key)
+
+	// The rejected uploads did not spend the budget, so a full minute's worth passes
+	if resp := upload(600); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d after the slot was freed, want 201", resp.StatusCode)
+	}
+
+	// Now the budget is spent; the slot was released after that upload
+	resp := upload(100)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d over the byte budget, want 429", resp.StatusCode)
+	}
+	expectHeaders(resp)
+	if policy := resp.Header.Get("RateLimit-Policy"); !strings.HasSuffix(policy, "w=60") {
+		t.Fatalf("RateLimit-Policy = %s, want the byte budget's minute window", policy)
+	}
+	if ok, _ := backend.Acquire(key, 1); !ok {
+		t.Fatal("upload refused for bytes kept its slot")
+	}
+}
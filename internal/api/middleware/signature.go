@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/client"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// protectedHeaders change what a request does, so they must be signed when
+// present.
+var protectedHeaders = []string{
+	"content-type",
+	"x-bucket-name",
+	"x-original-filename",
+	"x-expires-at",
+	"x-expires-in",
+	"x-bypass-governance-retention",
+}
+
+var errBadSignature = errors.New("invalid request signature")
+
+// signedAuth verifies HC-HMAC-SHA256 signed requests (see package client).
+type signedAuth struct {
+	credentials *service.CredentialService
+	maxSkew     time.Duration
+	nonces      *nonceCache
+}
+
+func newSignedAuth(credentials *service.CredentialService, maxSkew time.Duration) *signedAuth {
+	return &signedAuth{
+		credentials: credentials,
+		maxSkew:     maxSkew,
+		nonces:      &nonceCache{seen: make(map[string]time.Time)},
+	}
+}
+
+func (a *signedAuth) authenticate(c *fiber.Ctx, authorization string) (model.ApiCredential, error) {
+	params, ok := parseAuthorization(authorization)
+	if !ok {
+		return model.ApiCredential{}, errBadSignature
+	}
+
+	signed := strings.Split(params["SignedHeaders"], ";")
+	for _, name := range client.RequiredHeaders {
+		if !contains(signed, name) {
+			return model.ApiCredential{}, errBadSignature
+		}
+	}
+	for _, name := range protectedHeaders {
+		if c.Get(name) != "" && !contains(signed, name) {
+			return model.ApiCredential{}, errBadSignature
+		}
+	}
+
+	date := c.Get(client.HeaderDate)
+	at, err := time.Parse(client.DateFormat, date)
+	if err != nil {
+		return model.ApiCredential{}, errBadSignature
+	}
+	now := time.Now()
+	if at.Before(now.Add(-a.maxSkew)) || at.After(now.Add(a.maxSkew)) {
+		return model.ApiCredential{}, errors.New("request timestamp outside the allowed clock skew")
+	}
+
+	bodyHash := c.Get(client.HeaderContentSHA256)
+	if !hmac.Equal([]byte(bodyHash), []byte(client.HashBody(c.Request().Body()))) {
+		return model.ApiCredential{}, errBadSignature
+	}
+
+	headers := make(map[string]string, len(signed))
+	for _, name := range signed {
+		if name == "host" {
+			headers[name] = string(c.Request().Host())
+		} else {
+			headers[name] = c.Get(name)
+		}
+	}
+
+	canonical := client.CanonicalRequest(c.Method(), string(c.Request().URI().PathOriginal()),
+		string(c.Request().URI().QueryString()), headers, signed, bodyHash)
+	stringToSign := client.StringToSign(date, canonical)
+
+	credential, err := a.credentials.AuthenticateSigned(params["Credential"], func(signingKey []byte) bool {
+		expected := client.Signature(signingKey, stringToSign)
+		return hmac.Equal([]byte(expected), []byte(params["Signature"]))
+	})
+	if err != nil {
+		return model.ApiCredential{}, errBadSignature
+	}
+
+	// Nonces are only recorded for valid signatures, so they cannot be
+	// flooded by unauthenticated callers
+	nonce := c.Get(client.HeaderNonce)
+	if nonce == "" || !a.nonces.use(credential.ApiKey+":"+nonce, at.Add(a.maxSkew)) {
+		return model.ApiCredential{}, errors.New("request replayed")
+	}
+
+	return credential, nil
+}
+
+// parseAuthorization splits
+// "HC-HMAC-SHA256 Credential=key, SignedHeaders=a;b, Signature=hex".
+func parseAuthorization(header string) (map[string]string, bool) {
+	rest, found := strings.CutPrefix(header, client.Algorithm+" ")
+	if !found {
+		return nil, false
+	}
+
+	params := make(map[string]string, 3)
+	for _, part := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, false
+		}
+		params[name] = value
+	}
+
+	return params, params["Credential"] != "" && params["SignedHeaders"] != "" && params["Signature"] != ""
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nonceCache remembers nonces until the request they came with could no
+// longer pass the clock-skew check.
+type nonceCache struct {
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	inserts int
+}
+
+// use records a nonce and reports whether it was new.
+func (n *nonceCache) use(nonce string, expires time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if exp, ok := n.seen[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	n.seen[nonce] = expires
+
+	n.inserts++
+	if n.inserts%1000 == 0 {
+		for key, exp := range n.seen {
+			if now.After(exp) {
+				delete(n.seen, key)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/client"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const testCipherKey = "0123456789abcdef0123456789abcdef"
+
+// signedTestApp answers with the authenticated key, or 401 and the reason.
+func signedTestApp(t *testing.T) (*fiber.App, model.ApiCredential) {
+	t.Helper()
+	t.Setenv("STORAGE_CIPHER_KEY", testCipherKey)
+
+	db := newTestDB(t)
+	a := model.App{ID: uuid.New(), AppName: "signer"}
+	if err := db.Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	credentials := service.NewCredentialService(db)
+	credential, err := credentials.Issue(db, model.ApiCredential{AppID: a.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := newSignedAuth(credentials, 5*time.Minute)
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		verified, err := auth.authenticate(c, c.Get("Authorization"))
+		if err != nil {
+			return c.Status(401).SendString(err.Error())
+		}
+		return c.SendString(verified.ApiKey)
+	})
+	return app, credential
+}
+
+func send(t *testing.T, app *fiber.App, req *http.Request) (int, string) {
+	t.Helper()
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func newUpload(t *testing.T, path, body string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "http://storage.local"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Bucket-Name", "records")
+	return req
+}
+
+// signAt signs req as client.Signer does, but with the given timestamp.
+func signAt(req *http.Request, credential model.ApiCredential, body string, at time.Time) {
+	date := at.UTC().Format(client.DateFormat)
+	bodyHash := client.HashBody([]byte(body))
+	req.Header.Set(client.HeaderDate, date)
+	req.Header.Set(client.HeaderNonce, uuid.NewString())
+	req.Header.Set(client.HeaderContentSHA256, bodyHash)
+
+	signed := []string{"content-type", "host", "x-bucket-name", "x-hc-content-sha256", "x-hc-date", "x-hc-nonce"}
+	headers := map[string]string{"host": req.URL.Host}
+	for _, name := range signed[2:] {
+		headers[name] = req.Header.Get(name)
+	}
+	headers["content-type"] = req.Header.Get("Content-Type")
+
+	canonical := client.CanonicalRequest(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers, signed, bodyHash)
+	signature := client.Signature(client.DeriveSigningKey(credential.ApiSecret), client.StringToSign(date, canonical))
+	req.Header.Set("Authorization", client.Algorithm+" Credential="+credential.ApiKey+
+		", SignedHeaders="+strings.Join(signed, ";")+", Signature="+signature)
+}
+
+func TestSignedRequests(t *testing.T) {
+	app, credential := signedTestApp(t)
+	signer := client.NewSigner(credential.ApiKey, credential.ApiSecret)
+	path := "/api/v1/storage/files/upload?replicas=all"
+
+	t.Run("client signature verifies", func(t *testing.T) {
+		req := newUpload(t, path, "content")
+		if err := signer.Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		if status, body := send(t, app, req); status != 200 || body != credential.ApiKey {
+			t.Fatalf("status = %d (%s), want 200", status, body)
+		}
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		req := newUpload(t, path, "content")
+		signer.Sign(req)
+		replay := req.Clone(req.Context())
+		replay.Body, _ = req.GetBody()
+
+		if status, body := send(t, app, req); status != 200 {
+			t.Fatalf("first request: status = %d (%s)", status, body)
+		}
+		if status, body := send(t, app, replay); status != 401 || body != "request replayed" {
+			t.Fatalf("replay: status = %d (%s), want 401 request replayed", status, body)
+		}
+	})
+
+	t.Run("expired date", func(t *testing.T) {
+		fresh := newUpload(t, path, "content")
+		signAt(fresh, credential, "content", time.Now())
+		if status, body := send(t, app, fresh); status != 200 {
+			t.Fatalf("signAt with the current time: status = %d (%s)", status, body)
+		}
+
+		for _, at := range []time.Time{time.Now().Add(-6 * time.Minute), time.Now().Add(6 * time.Minute)} {
+			req := newUpload(t, path, "content")
+			signAt(req, credential, "content", at)
+			if status, body := send(t, app, req); status != 401 || !strings.Contains(body, "clock skew") {
+				t.Fatalf("date %s: status = %d (%s), want 401 for clock skew", at, status, body)
+			}
+		}
+	})
+
+	rejected := map[string]func() *http.Request{
+		"wrong secret": func() *http.Request {
+			req := newUpload(t, path, "content")
+			client.NewSigner(credential.ApiKey, "not-the-secret").Sign(req)
+			return req
+		},
+		"unknown key": func() *http.Request {
+			req := newUpload(t, path, "content")
+			client.NewSigner("unknown", credential.ApiSecret).Sign(req)
+			return req
+		},
+		"tampered body": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Body = io.NopCloser(strings.NewReader("CONTENT"))
+			return req
+		},
+		"tampered body and hash": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Body = io.NopCloser(strings.NewReader("CONTENT"))
+			req.Header.Set(client.HeaderContentSHA256, client.HashBody([]byte("CONTENT")))
+			return req
+		},
+		"tampered path": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.URL.Path = "/api/v1/storage/files/other"
+			return req
+		},
+		"tampered query": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.URL.RawQuery = "replicas=none"
+			return req
+		},
+		"tampered method": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Method = http.MethodPut
+			return req
+		},
+		"tampered signed header": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Header.Set("X-Bucket-Name", "other-records")
+			return req
+		},
+		"unsigned protected header": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Header.Set("X-Bypass-Governance-Retention", "true")
+			return req
+		},
+		"missing nonce in signed headers": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			auth := strings.Replace(req.Header.Get("Authorization"), ";x-hc-nonce", "", 1)
+			req.Header.Set("Authorization", auth)
+			return req
+		},
+		"malformed authorization": func() *http.Request {
+			req := newUpload(t, path, "content")
+			signer.Sign(req)
+			req.Header.Set("Authorization", client.Algorithm+" Credential="+credential.ApiKey)
+			return req
+		},
+	}
+	for name, build := range rejected {
+		t.Run(name, func(t *testing.T) {
+			if status, body := send(t, app, build()); status != 401 {
+				t.Fatalf("status = %d (%s), want 401", status, body)
+			}
+		})
+	}
+}
+
+func TestStorageAuthAcceptsSignedRequests(t *testing.T) {
+	t.Setenv("STORAGE_CIPHER_KEY", testCipherKey)
+	db := newTestDB(t)
+	a := model.App{ID: uuid.New(), AppName: "signer"}
+	db.Create(&a)
+	credential, err := service.NewCredentialService(db).Issue(db, model.ApiCredential{AppID: a.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/files", StorageAuth(db, &service.AuditService{}), func(c *fiber.Ctx) error {
+		if c.Locals("app_id") != a.ID {
+			return c.SendStatus(500)
+		}
+		return c.SendStatus(204)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://storage.local/files", nil)
+	if err := client.NewSigner(credential.ApiKey, credential.ApiSecret).Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := send(t, app, req); status != 204 {
+		t.Fatalf("status = %d (%s), want 204", status, body)
+	}
+
+	// The secret itself is never sent
+	for name, values := range req.Header {
+		for _, v := range values {
+			if strings.Contains(v, credential.ApiSecret) {
+				t.Fatalf("header %s carries the secret", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/config"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated in-memory database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection keeps a single in-memory database for the whole test
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := config.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -3,14 +3,17 @@ package routes
 import (
 	"github.com/JAreyes98/healthconnect-storage-service/internal/api/handlers"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/api/middleware"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/auth"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/ratelimit"
 	"github.com/JAreyes98/healthconnect-storage-service/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(app *fiber.App, db *gorm.DB, auditSvc *service.AuditService) {
+func SetupRoutes(app *fiber.App, db *gorm.DB, auditSvc *service.AuditService, adminVerifier *auth.Verifier, limits ratelimit.Backend) {
 	admin := handlers.NewAdminHandler(db, auditSvc)
 	replicate := handlers.NewReplicationHandler(db)
+	lifecycle := handlers.NewLifecycleHandler(db)
 	storageHandler := handlers.NewStorageHandler(db, auditSvc)
 
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -24,13 +27,20 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, auditSvc *service.AuditService) {
 	v1 := app.Group("/api/v1/storage")
 
 	// 2. Definimos el grupo ADMIN (hijo de v1) -> /api/v1/admin
-	adminGroup := v1.Group("/admin")
+	adminGroup := v1.Group("/admin", middleware.AdminAuth(adminVerifier, auditSvc))
 
 	// Apps (Rutas finales: /api/v1/admin/apps...)
 	adminGroup.Post("/apps", admin.CreateApp)
 	adminGroup.Get("/apps", admin.GetAllApps)
 	adminGroup.Put("/apps/:id", admin.UpdateApp)
 	adminGroup.Delete("/apps/:id", admin.DeleteApp)
+	adminGroup.Get("/apps/:id/credentials", admin.GetCredentials)
+	adminGroup.Post("/apps/:id/credentials", admin.CreateCredential)
+	adminGroup.Post("/apps/:id/credentials/rotate", admin.RotateCredentials)
+	adminGroup.Delete("/apps/:id/credentials/:credentialId", admin.RevokeCredential)
+	adminGroup.Get("/apps/:id/certificates", admin.GetCertificates)
+	adminGroup.Post("/apps/:id/certificates", admin.RegisterCertificate)
+	adminGroup.Delete("/apps/:id/certificates/:certificateId", admin.RevokeCertificate)
 
 	// Buckets
 	adminGroup.Get("/buckets", admin.GetAllBuckets)
@@ -38,6 +48,10 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, auditSvc *service.AuditService) {
 	adminGroup.Get("/buckets/app/:appId", admin.GetBucketsByApp)
 	adminGroup.Get("/buckets/:id", admin.GetBucketById)
 	adminGroup.Get("/buckets/:id/files", admin.GetBucketFiles)
+	adminGroup.Put("/buckets/:id/quota", admin.UpdateBucketQuota)
+
+	// Analytics
+	adminGroup.Get("/analytics", admin.GetAnalytics)
 
 	// Replication
 	adminGroup.Post("/replication", replicate.CreateRule)
@@ -46,10 +60,36 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, auditSvc *service.AuditService) {
 	adminGroup.Delete("/replication/:id", replicate.DeleteRule)
 	adminGroup.Patch("/replication/:id/toggle", replicate.ToggleRule)
 
+	// Lifecycle
+	adminGroup.Post("/lifecycle", lifecycle.CreateRule)
+	adminGroup.Get("/lifecycle", lifecycle.GetRules)
+	adminGroup.Get("/lifecycle/bucket/:bucketId", lifecycle.GetRulesByBucket)
+	adminGroup.Delete("/lifecycle/:id", lifecycle.DeleteRule)
+	adminGroup.Patch("/lifecycle/:id/toggle", lifecycle.ToggleRule)
+
 	// 3. Definimos el grupo STORAGE (hijo de v1) -> /api/v1/storage
 	// NOTA: Aquí usamos 'v1.Group', NO 'adminGroup.Group'
-	storageGroup := v1.Group("/files", middleware.StorageAuth(db))
+	limiter := middleware.NewRateLimiter(db, limits, auditSvc)
+	storageGroup := v1.Group("/files", middleware.StorageAuth(db, auditSvc), limiter.Requests())
 	storageGroup.Get("/view/:id", storageHandler.ViewFile)
-	storageGroup.Post("/upload", storageHandler.UploadFile)
+	storageGroup.Post("/upload", limiter.Uploads(), storageHandler.UploadFile)
 	storageGroup.Get("/download/:id", storageHandler.DownloadFile)
+	storageGroup.Get("/", storageHandler.ListFiles)
+	storageGroup.Get("/trash", storageHandler.ListTrash)
+	storageGroup.Post("/uploads", storageHandler.BeginDirectUpload)
+	storageGroup.Post("/uploads/:id/complete", storageHandler.CompleteDirectUpload)
+	storageGroup.Get("/:id", storageHandler.GetMetadata)
+	storageGroup.Put("/:id", limiter.Uploads(), storageHandler.UpdateFile)
+	storageGroup.Delete("/:id", storageHandler.DeleteFile)
+	storageGroup.Post("/:id/restore", storageHandler.RestoreFile)
+	storageGroup.Put("/:id/legal-hold", storageHandler.SetLegalHold)
+	storageGroup.Put("/:id/retention", storageHandler.SetRetention)
+	storageGroup.Get("/:id/versions", storageHandler.GetVersions)
+	storageGroup.Get("/:id/versions/:version", storageHandler.DownloadVersion)
+	storageGroup.Post("/:id/versions/:version/restore", storageHandler.RestoreVersion)
+	storageGroup.Post("/:id/share", storageHandler.CreateShare)
+	storageGroup.Get("/:id/presign", storageHandler.PresignDownload)
+
+	// Enlaces compartidos: públicos, el token firmado es la credencial
+	v1.Get("/share/:token", storageHandler.OpenShare)
 }
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefetch limits how often an unknown key ID can trigger a JWKS download.
+const minRefetch = time.Minute
+
+var ErrUnknownKey = errors.New("signing key not found in JWKS")
+
+// KeySet holds the public keys of the identity provider, read from a JWKS
+// file or URL. Keys from a URL are refreshed periodically and when a token
+// names a key that is not known yet, so provider key rotation needs no restart.
+type KeySet struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	checked time.Time
+}
+
+// NewKeySet loads a JWKS from file, or from url when file is empty. refresh
+// is how often URL keys are reloaded; files are read once.
+func NewKeySet(file, url string, refresh time.Duration) (*KeySet, error) {
+	if file == "" && url == "" {
+		return nil, errors.New("no JWKS file or URL configured")
+	}
+
+	ks := &KeySet{
+		file:    file,
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Key returns the public key with the given key ID. When the set has a single
+// key, tokens without a kid use it. If the provider cannot be reached, the
+// keys loaded last stay in use.
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	if ks.url != "" && ks.refresh > 0 && ks.checkedBefore(ks.refresh) {
+		ks.load()
+	}
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	if ks.url == "" || !ks.checkedBefore(minRefetch) {
+		return nil, ErrUnknownKey
+	}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (ks *KeySet) checkedBefore(age time.Duration) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return time.Since(ks.checked) > age
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *KeySet) load() error {
+	ks.mu.Lock()
+	ks.checked = time.Now()
+	ks.mu.Unlock()
+
+	var data []byte
+	var err error
+	if ks.file != "" {
+		data, err = os.ReadFile(ks.file)
+	} else {
+		data, err = ks.download()
+	}
+	if err != nil {
+		return fmt.Errorf("reading JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+func (ks *KeySet) download() ([]byte, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the RSA, EC and Ed25519 signing keys of a JWKS document.
+// Encryption keys and unsupported key types are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RoleAdmin   = "storage-admin"
+	RoleAuditor = "storage-auditor"
+)
+
+// Only asymmetric algorithms: the key type of each is checked by the library,
+// so a token cannot pick HMAC and use a public key as the secret.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Identity is the caller described by a verified token.
+type Identity struct {
+	Subject string
+	Name    string
+	Roles   []string
+}
+
+// HasRole reports whether the identity carries the role.
+func (id Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// String names the caller for audit logs.
+func (id Identity) String() string {
+	if id.Name != "" && id.Name != id.Subject {
+		return id.Name + " (" + id.Subject + ")"
+	}
+	return id.Subject
+}
+
+// Verifier validates tokens issued by the identity provider.
+type Verifier struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	// RolesClaim is a dotted path to the roles, such as "roles" or
+	// "realm_access.roles". It may hold an array or a space-separated string.
+	RolesClaim string
+}
+
+// Verify checks the signature, expiry, issuer and audience of a token and
+// returns the caller's identity. Without an issuer and an audience every token
+// is refused, since any client of the identity provider would pass.
+func (v *Verifier) Verify(token string) (Identity, error) {
+	if v.Issuer == "" || v.Audience == "" {
+		return Identity{}, errors.New("verifier has no issuer or audience configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithAudience(v.Audience),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.Keys.Key(kid)
+	}, opts...)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return Identity{}, errors.New("token has no subject")
+	}
+
+	id := Identity{Subject: subject, Roles: rolesAt(claims, v.RolesClaim)}
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			id.Name = name
+			break
+		}
+	}
+	return id, nil
+}
+
+func rolesAt(claims jwt.MapClaims, path string) []string {
+	if path == "" {
+		path = "roles"
+	}
+
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch roles := value.(type) {
+	case string:
+		return strings.Fields(roles)
+	case []interface{}:
+		out := make([]string, 0, len(roles))
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestKeys writes a JWKS with one Ed25519 key and returns it with the
+// private key.
+func newTestKeys(t *testing.T) (*KeySet, ed25519.PrivateKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := `{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"test","x":"` + base64.RawURLEncoding.EncodeToString(public) + `"}]}`
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, []byte(jwks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeySet(file, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, private
+}
+
+func TestVerifierChecksIssuerAndAudience(t *testing.T) {
+	keys, private := newTestKeys(t)
+	sign := func(issuer, audience string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"sub":   "ops-1",
+			"iss":   issuer,
+			"aud":   audience,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"roles": []string{RoleAdmin},
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	verifier := &Verifier{Keys: keys, Issuer: "https://idp.example", Audience: "storage-service"}
+	id, err := verifier.Verify(sign("https://idp.example", "storage-service"))
+	if err != nil || id.Subject != "ops-1" || !id.HasRole(RoleAdmin) {
+		t.Fatalf("valid token: %+v, %v", id, err)
+	}
+
+	for name, token := range map[string]string{
+		"other audience": sign("https://idp.example", "billing-service"),
+		"other issuer":   sign("https://other-idp.example", "storage-service"),
+	} {
+		if _, err := verifier.Verify(token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// A verifier missing either setting refuses everything
+	for _, v := range []*Verifier{
+		{Keys: keys, Issuer: "https://idp.example"},
+		{Keys: keys, Audience: "storage-service"},
+	} {
+		if _, err := v.Verify(sign("https://idp.example", "storage-service")); err == nil {
+			t.Errorf("verifier %+v accepted a token", v)
+		}
+	}
+}
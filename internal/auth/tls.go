@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSFiles serves the server certificate and the client CA bundle from PEM
+// files. Files are checked for changes at most every refresh, during
+// handshakes, so renewed certificates and CAs apply without a restart. A
+// broken update keeps the files loaded last in use.
+type TLSFiles struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	refresh  time.Duration
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+	checked  time.Time
+}
+
+// NewTLSFiles loads the certificate, its key and the optional client CA
+// bundle.
+func NewTLSFiles(certFile, keyFile, caFile string, refresh time.Duration) (*TLSFiles, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key file")
+	}
+
+	t := &TLSFiles{certFile: certFile, keyFile: keyFile, caFile: caFile, refresh: refresh}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Config returns a server TLS config using the current files. clientAuth is
+// applied only when a client CA bundle is configured.
+func (t *TLSFiles) Config(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.maybeReload()
+
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*t.cert},
+			}
+			if t.clientCA != nil {
+				config.ClientCAs = t.clientCA
+				config.ClientAuth = clientAuth
+			}
+			return config, nil
+		},
+	}
+}
+
+func (t *TLSFiles) maybeReload() {
+	t.mu.RLock()
+	due := t.refresh > 0 && time.Since(t.checked) >= t.refresh
+	t.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	t.mu.Lock()
+	t.checked = time.Now()
+	changed := t.changed()
+	t.mu.Unlock()
+
+	if changed {
+		if err := t.load(); err != nil {
+			log.Printf("Warning: could not reload TLS files, keeping the previous ones: %v", err)
+		} else {
+			log.Printf("TLS certificate and client CAs reloaded")
+		}
+	}
+}
+
+// changed reports whether any file's modification time moved. t.mu must be
+// held.
+func (t *TLSFiles) changed() bool {
+	for file, modTime := range t.modTimes {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TLSFiles) load() error {
+	modTimes := make(map[string]time.Time, 3)
+	for _, file := range []string{t.certFile, t.keyFile, t.caFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if t.caFile != "" {
+		pem, err := os.ReadFile(t.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", t.caFile)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert = &cert
+	t.clientCA = pool
+	t.modTimes = modTimes
+	t.checked = time.Now()
+	return nil
+}
@@ -0,0 +1,98 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	None = ""
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// incompressible lists content types that are already compressed, where a
+// second pass only costs CPU.
+var incompressible = map[string]bool{
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/heic":                   true,
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+}
+
+// Valid reports whether algo is a supported bucket setting.
+func Valid(algo string) bool {
+	return algo == None || algo == Gzip || algo == Zstd
+}
+
+// ShouldSkip reports whether content of this type is already compressed.
+func ShouldSkip(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if incompressible[ct] {
+		return true
+	}
+	return strings.HasPrefix(ct, "video/") || strings.HasPrefix(ct, "audio/")
+}
+
+func Compress(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algo)
+	}
+}
+
+func Decompress(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case None:
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case Zstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algo)
+	}
+}
@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DeriveKey returns a 32-byte key for one purpose, derived from
+// STORAGE_CIPHER_KEY so that different uses never share key material.
+func DeriveKey(purpose string) ([]byte, error) {
+	master, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil), nil
+}
+
+// ContentKey returns the address used to deduplicate data inside a bucket.
+//
+// Plain buckets use the SHA-256 of the content. Encrypted buckets use
+// HMAC-SHA256(K_bucket, content) with K_bucket = HMAC-SHA256(STORAGE_CIPHER_KEY,
+// "dedup:" + bucketID). Identical plaintext still maps to the same address
+// within the bucket, so deduplication works before encryption, but the stored
+// name does not reveal a public hash of the document (no confirmation-of-file
+// attacks against the object store) and addresses cannot be correlated across
+// buckets. The blob itself is still encrypted with a random nonce.
+func ContentKey(bucketID string, data []byte, keyed bool) (string, error) {
+	if !keyed {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	bucketKey, err := DeriveKey("dedup:" + bucketID)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, bucketKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
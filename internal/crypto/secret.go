@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters (OWASP minimum: 19 MiB, 2 passes, 1 lane).
+const (
+	argonMemory  = 19 * 1024
+	argonTime    = 2
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+
+	// verifiedCacheSize bounds the cache of recently verified secrets.
+	verifiedCacheSize = 10000
+)
+
+// HashSecret returns a salted argon2id hash of secret in the PHC string
+// format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+func HashSecret(secret string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(secret), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+var (
+	verifiedMu sync.Mutex
+	verified   = make(map[string][32]byte)
+)
+
+// VerifySecret reports whether secret matches an encoded hash from
+// HashSecret, comparing in constant time. Argon2 is deliberately slow, so a
+// successful match is remembered per hash: later requests with the same
+// secret only cost a SHA-256. Changing or deleting the hash invalidates it.
+func VerifySecret(secret, encoded string) bool {
+	digest := sha256.Sum256([]byte(secret))
+
+	verifiedMu.Lock()
+	known, ok := verified[encoded]
+	verifiedMu.Unlock()
+	if ok {
+		return subtle.ConstantTimeCompare(known[:], digest[:]) == 1
+	}
+
+	if !verifyArgon2(secret, encoded) {
+		return false
+	}
+
+	verifiedMu.Lock()
+	if len(verified) >= verifiedCacheSize {
+		verified = make(map[string][32]byte)
+	}
+	verified[encoded] = digest
+	verifiedMu.Unlock()
+	return true
+}
+
+func verifyArgon2(secret, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+
+	got := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
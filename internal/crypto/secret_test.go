@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+// knownHash is the argon2id test vector of golang.org/x/crypto/argon2 for
+// "password" with salt "somesalt" (t=2, m=64 KiB, p=1, 24 bytes), in PHC form.
+const knownHash = "$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3"
+
+func TestVerifySecretKnownAnswer(t *testing.T) {
+	if !VerifySecret("password", knownHash) {
+		t.Fatal("known argon2id hash did not verify")
+	}
+	// A cached match must not let another secret through
+	for _, wrong := range []string{"Password", "password ", ""} {
+		if VerifySecret(wrong, knownHash) {
+			t.Errorf("%q verified against the hash of \"password\"", wrong)
+		}
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	first, err := HashSecret("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := HashSecret("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(first, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("hash %q does not use the expected parameters", first)
+	}
+	if first == second {
+		t.Fatal("two hashes of the same secret share a salt")
+	}
+	if strings.Contains(first, "s3cret") {
+		t.Fatal("hash contains the secret")
+	}
+	if !VerifySecret("s3cret", first) || !VerifySecret("s3cret", second) {
+		t.Fatal("secret does not verify against its hashes")
+	}
+	if VerifySecret("s3cret!", first) {
+		t.Fatal("wrong secret verified")
+	}
+}
+
+func TestVerifySecretRejectsMalformedHashes(t *testing.T) {
+	for name, encoded := range map[string]string{
+		"empty":          "",
+		"plaintext":      "password",
+		"argon2i":        "$argon2i$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3",
+		"other version":  "$argon2id$v=16$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3",
+		"bad parameters": "$argon2id$v=19$m=64;t=2$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3",
+		"bad salt":       "$argon2id$v=19$m=64,t=2,p=1$!!$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3",
+		"empty hash":     "$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$",
+		"extra field":    knownHash + "$x",
+		"changed hash":   strings.Replace(knownHash, "Bo1i", "Bo1j", 1),
+	} {
+		if VerifySecret("password", encoded) {
+			t.Errorf("%s: %q verified", name, encoded)
+		}
+	}
+}
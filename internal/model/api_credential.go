@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApiCredential is one key/secret pair of an app. An app can hold several,
+// so a new credential can be rolled out while the old one still works.
+type ApiCredential struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	ApiKey      string     `gorm:"unique;not null" json:"api_key"`
+	ApiSecret   string     `gorm:"-" json:"api_secret,omitempty"` // only set in the creation response
+	SecretHash  string     `gorm:"not null" json:"-"`
+	SigningKey  []byte     `json:"-"` // HMAC request-signing key, encrypted with the master key
+	Label       string     `json:"label"`
+	Buckets     []string   `gorm:"serializer:json" json:"buckets"`     // bucket names; empty means all
+	Permissions []string   `gorm:"serializer:json" json:"permissions"` // read, write, delete, list; empty means all but the privileged ones
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+const (
+	PermissionRead   = "read"
+	PermissionWrite  = "write"
+	PermissionDelete = "delete"
+	PermissionList   = "list"
+
+	// Privileged permissions are never implied: they must be listed.
+	PermissionBypassRetention = "bypass_retention"
+	PermissionLegalHold       = "legal_hold"
+)
+
+// Can reports whether the credential grants permission. Credentials without
+// permissions predate scopes and grant everything except the privileged
+// permissions.
+func (c ApiCredential) Can(permission string) bool {
+	if len(c.Permissions) == 0 && !privileged(permission) {
+		return true
+	}
+	return containsString(c.Permissions, permission)
+}
+
+func privileged(permission string) bool {
+	return permission == PermissionBypassRetention || permission == PermissionLegalHold
+}
+
+// AllowsBucket reports whether the credential may use the named bucket.
+func (c ApiCredential) AllowsBucket(name string) bool {
+	return len(c.Buckets) == 0 || containsString(c.Buckets, name)
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the credential may authenticate at now.
+func (c ApiCredential) Valid(now time.Time) bool {
+	return c.RevokedAt == nil && (c.ExpiresAt == nil || now.Before(*c.ExpiresAt))
+}
@@ -4,10 +4,19 @@ package model
 import "github.com/google/uuid"
 
 type App struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id,omitempty"`
-	AppName   string    `gorm:"unique;not null" json:"app_name"`
-	ApiKey    string    `gorm:"unique;not null" json:"api_key"`
-	ApiSecret string    `gorm:"not null" json:"api_secret"`
-	IsActive  bool      `gorm:"default:true" json:"is_active"`
-	Buckets   []Bucket  `gorm:"foreignKey:AppID" json:"buckets"`
+	ID                   uuid.UUID `gorm:"type:uuid;primaryKey" json:"id,omitempty"`
+	AppName              string    `gorm:"unique;not null" json:"app_name"`
+	ApiKey               string    `gorm:"-" json:"api_key,omitempty"`    // first credential, creation response only
+	ApiSecret            string    `gorm:"-" json:"api_secret,omitempty"` // only set in the creation response
+	IsActive             bool      `gorm:"default:true" json:"is_active"`
+	MaxBytes             int64     `gorm:"not null;default:0" json:"max_bytes"`
+	MaxFiles             int64     `gorm:"not null;default:0" json:"max_files"`
+	MaxFileSize          int64     `gorm:"not null;default:0" json:"max_file_size"`
+	UsedBytes            int64     `gorm:"not null;default:0" json:"used_bytes"`
+	FileCount            int64     `gorm:"not null;default:0" json:"file_count"`
+	RequestsPerSecond    int       `gorm:"not null;default:0" json:"requests_per_second"` // rate limits: zero means unlimited
+	ConcurrentUploads    int       `gorm:"not null;default:0" json:"concurrent_uploads"`
+	UploadBytesPerMinute int64     `gorm:"not null;default:0" json:"upload_bytes_per_minute"`
+	AllowedCIDRs         []string  `gorm:"column:allowed_cidrs;serializer:json" json:"allowed_cidrs"` // client networks; empty means any
+	Buckets              []Bucket  `gorm:"foreignKey:AppID" json:"buckets"`
 }
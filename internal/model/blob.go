@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Blob is a content-addressed object in a dedup bucket. Every FileMetadata
+// row with the same bucket and content hash shares it; RefCount tracks them.
+type Blob struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	BucketID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_blob_bucket_hash" json:"bucketId"`
+	Hash         string    `gorm:"not null;uniqueIndex:idx_blob_bucket_hash" json:"hash"`
+	PhysicalPath string    `gorm:"not null" json:"physicalPath"`
+	Size         int64     `json:"size"`
+	Compression  string    `json:"compression,omitempty"`
+	RefCount     int64     `gorm:"not null;default:0" json:"refCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -4,13 +4,25 @@ package model
 import "github.com/google/uuid"
 
 type Bucket struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	AppID        uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
-	App          App       `gorm:"foreignKey:AppID" json:"app"`
-	Name         string    `json:"name"`
-	ProviderType string    `json:"provider_type"`
-	Config       string    `json:"config"`
-	IsDefault    bool      `json:"is_default"`
-	Cipher       bool      `json:"cipher" gorm:"default:false"`
-	TotalSize    int64     `gorm:"-" json:"total_size"`
+	ID                 uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID              uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
+	App                App       `gorm:"foreignKey:AppID" json:"app"`
+	Name               string    `json:"name"`
+	ProviderType       string    `json:"provider_type"`
+	Config             string    `json:"config"`
+	IsDefault          bool      `json:"is_default"`
+	Cipher             bool      `json:"cipher" gorm:"default:false"`
+	Dedup              bool      `json:"dedup" gorm:"default:false"`
+	Compression        string    `json:"compression"`
+	TrashRetentionDays int       `json:"trash_retention_days"`
+	RetentionMode      string    `json:"retention_mode"`
+	RetentionDays      int       `json:"retention_days"`
+	DefaultTTLHours    int       `json:"default_ttl_hours"`
+	MaxBytes           int64     `gorm:"not null;default:0" json:"max_bytes"`
+	MaxFiles           int64     `gorm:"not null;default:0" json:"max_files"`
+	MaxFileSize        int64     `gorm:"not null;default:0" json:"max_file_size"`
+	UsedBytes          int64     `gorm:"not null;default:0" json:"used_bytes"`
+	FileCount          int64     `gorm:"not null;default:0" json:"file_count"`
+	TotalSize          int64     `gorm:"-" json:"total_size"`
+	StoredSize         int64     `gorm:"-" json:"stored_size"`
 }
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientCertificate maps a TLS client certificate, by subject or by
+// fingerprint, to an app. It authenticates like an API credential, with the
+// same optional scope.
+type ClientCertificate struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	Subject     string     `gorm:"index" json:"subject,omitempty"`     // RFC 2253 DN, e.g. "CN=lab-gateway,O=Hospital"
+	Fingerprint string     `gorm:"index" json:"fingerprint,omitempty"` // hex SHA-256 of the DER certificate
+	Label       string     `json:"label"`
+	Buckets     []string   `gorm:"serializer:json" json:"buckets"`     // bucket names; empty means all
+	Permissions []string   `gorm:"serializer:json" json:"permissions"` // read, write, delete, list; empty means all
+	CreatedAt   time.Time  `json:"created_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Credential returns the API credential the certificate stands for, so
+// scope checks and audits treat both the same way.
+func (c ClientCertificate) Credential() ApiCredential {
+	name := c.Fingerprint
+	if name == "" {
+		name = c.Subject
+	}
+	return ApiCredential{
+		ID:          c.ID,
+		AppID:       c.AppID,
+		ApiKey:      "cert:" + name,
+		Label:       c.Label,
+		Buckets:     c.Buckets,
+		Permissions: c.Permissions,
+		CreatedAt:   c.CreatedAt,
+	}
+}
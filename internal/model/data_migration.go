@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// DataMigration marks a one-off data migration as applied, so it is not run
+// again on the next start.
+type DataMigration struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
@@ -4,17 +4,30 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type FileMetadata struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	AppID        uuid.UUID `gorm:"type:uuid;not null" json:"appId"`
-	BucketID     uuid.UUID `gorm:"type:uuid;not null" json:"bucketId"`
-	OriginalName string    `gorm:"not null" json:"originalName"`
-	PhysicalPath string    `gorm:"not null" json:"physicalPath"`
-	FileSize     int64     `json:"fileSize"`
-	ContentType  string    `json:"contentType"`
-	CreatedAt    time.Time `json:"createdAt"`
-	IsCiphered   bool      `gorm:"-" json:"is_ciphered"`
-	Bucket       Bucket    `gorm:"foreignKey:BucketID" json:"bucket"`
+	ID             uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID          uuid.UUID      `gorm:"type:uuid;not null" json:"appId"`
+	BucketID       uuid.UUID      `gorm:"type:uuid;not null" json:"bucketId"`
+	OriginalName   string         `gorm:"not null" json:"originalName"`
+	PhysicalPath   string         `gorm:"not null" json:"physicalPath"`
+	FileSize       int64          `json:"fileSize"`
+	StoredSize     int64          `json:"storedSize"`
+	Compression    string         `json:"compression,omitempty"`
+	ContentType    string         `json:"contentType"`
+	ContentHash    string         `gorm:"index" json:"contentHash,omitempty"`
+	ReplicaOf      *uuid.UUID     `gorm:"type:uuid;index" json:"replicaOf,omitempty"`
+	Version        int            `gorm:"not null;default:1" json:"version"`
+	RetentionMode  string         `json:"retentionMode,omitempty"`
+	RetainUntil    *time.Time     `json:"retainUntil,omitempty"`
+	LegalHold      bool           `gorm:"default:false" json:"legalHold"`
+	ExpiresAt      *time.Time     `gorm:"index" json:"expiresAt,omitempty"`
+	LastAccessedAt *time.Time     `json:"lastAccessedAt,omitempty"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
+	IsCiphered     bool           `gorm:"-" json:"is_ciphered"`
+	Bucket         Bucket         `gorm:"foreignKey:BucketID" json:"bucket"`
 }
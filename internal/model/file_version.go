@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVersion is an earlier version of a FileMetadata row. The row itself
+// always describes the current version; overwriting it archives the previous
+// state here.
+type FileVersion struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	FileID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_file_version" json:"fileId"`
+	Version      int       `gorm:"not null;uniqueIndex:idx_file_version" json:"version"`
+	OriginalName string    `json:"originalName"`
+	PhysicalPath string    `gorm:"not null" json:"-"`
+	FileSize     int64     `json:"fileSize"`
+	StoredSize   int64     `json:"storedSize"`
+	ContentType  string    `json:"contentType"`
+	Compression  string    `json:"compression,omitempty"`
+	ContentHash  string    `json:"contentHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	IsCurrent    bool      `gorm:"-" json:"isCurrent"`
+}
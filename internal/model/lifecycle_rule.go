@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LifecycleRule moves or deletes files of a bucket once they are older than
+// AfterDays, measured from creation or from the last read (Basis).
+type LifecycleRule struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID          uuid.UUID  `gorm:"type:uuid;not null" json:"appId"`
+	BucketID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"bucketId"`
+	Action         string     `gorm:"not null" json:"action"`
+	Basis          string     `gorm:"not null;default:CREATED" json:"basis"`
+	AfterDays      int        `gorm:"not null" json:"afterDays"`
+	TargetBucketID *uuid.UUID `gorm:"type:uuid" json:"targetBucketId,omitempty"`
+	Active         bool       `gorm:"default:true" json:"active"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	Bucket         Bucket     `gorm:"foreignKey:BucketID" json:"bucket"`
+	TargetBucket   *Bucket    `gorm:"foreignKey:TargetBucketID" json:"targetBucket,omitempty"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PendingUpload is a direct upload that was presigned but not completed yet.
+// Its ID becomes the file ID on completion.
+type PendingUpload struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID           uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	BucketID        uuid.UUID  `gorm:"type:uuid;not null" json:"bucket_id"`
+	Bucket          Bucket     `gorm:"foreignKey:BucketID" json:"-"`
+	CredentialID    uuid.UUID  `gorm:"type:uuid" json:"credential_id"`
+	OriginalName    string     `gorm:"not null" json:"original_name"`
+	PhysicalPath    string     `gorm:"not null" json:"-"`
+	ContentType     string     `json:"content_type"`
+	Size            int64      `gorm:"not null" json:"size"`
+	FileExpiresAt   *time.Time `json:"file_expires_at,omitempty"` // TTL of the file once completed
+	UploadExpiresAt time.Time  `gorm:"not null;index" json:"upload_expires_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
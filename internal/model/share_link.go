@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink backs a signed, time-limited URL to a file. The URL itself carries
+// the signed terms; the row counts downloads.
+type ShareLink struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	FileID       uuid.UUID `gorm:"type:uuid;not null;index" json:"file_id"`
+	AppID        uuid.UUID `gorm:"type:uuid;not null;index" json:"app_id"`
+	CredentialID uuid.UUID `gorm:"type:uuid" json:"credential_id"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	MaxDownloads int       `gorm:"not null;default:0" json:"max_downloads"` // 0 means unlimited
+	Downloads    int       `gorm:"not null;default:0" json:"downloads"`
+	AllowedIP    string    `json:"allowed_ip,omitempty"` // IP or CIDR; empty means any
+	Disposition  string    `gorm:"not null" json:"disposition"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageStat is the net change in usage of a bucket for one content type on
+// one day. Summing all days gives current usage; the days give the growth.
+type UsageStat struct {
+	Day         time.Time `gorm:"type:date;primaryKey" json:"day"`
+	BucketID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"bucketId"`
+	ContentType string    `gorm:"primaryKey" json:"contentType"`
+	AppID       uuid.UUID `gorm:"type:uuid;not null;index" json:"appId"`
+	Bytes       int64     `gorm:"not null;default:0" json:"bytes"`
+	StoredBytes int64     `gorm:"not null;default:0" json:"storedBytes"`
+	Files       int64     `gorm:"not null;default:0" json:"files"`
+}
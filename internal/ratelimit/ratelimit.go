@@ -0,0 +1,133 @@
+// Package ratelimit implements token buckets and concurrency slots behind a
+// Backend, in process by default or shared through Redis.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of taking tokens from a bucket.
+type Decision struct {
+	Allowed    bool
+	Limit      int64         // bucket capacity
+	Remaining  int64         // whole tokens left
+	RetryAfter time.Duration // until enough tokens are back; zero when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Backend stores rate-limit state.
+type Backend interface {
+	// Take removes cost tokens from the bucket at key, which refills at rate
+	// tokens per second up to burst.
+	Take(key string, rate, burst, cost float64) (Decision, error)
+	// Acquire takes one of limit concurrent slots at key.
+	Acquire(key string, limit int) (bool, error)
+	// Release returns a slot taken with Acquire.
+	Release(key string) error
+}
+
+// decide builds a Decision from the tokens left after a take.
+func decide(allowed bool, tokens, rate, burst, cost float64) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int64(burst),
+		Remaining: int64(math.Floor(tokens)),
+		Reset:     seconds((burst - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = seconds((cost - tokens) / rate)
+	}
+	return d
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryBackend keeps buckets and slots in process. Limits then apply per
+// instance.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	slots   map[string]int
+	takes   int
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets: make(map[string]*bucket),
+		slots:   make(map[string]int),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryBackend) Take(key string, rate, burst, cost float64) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	allowed := b.tokens >= cost
+	if allowed {
+		b.tokens -= cost
+	}
+
+	m.takes++
+	if m.takes%10000 == 0 {
+		m.prune(now)
+	}
+
+	return decide(allowed, b.tokens, rate, burst, cost), nil
+}
+
+// prune drops buckets idle long enough to have refilled; recreating them
+// full is equivalent.
+func (m *MemoryBackend) prune(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.last) > 10*time.Minute {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func (m *MemoryBackend) Acquire(key string, limit int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.slots[key] >= limit {
+		return false, nil
+	}
+	m.slots[key]++
+	return true, nil
+}
+
+func (m *MemoryBackend) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.slots[key] <= 1 {
+		delete(m.slots, key)
+	} else {
+		m.slots[key]--
+	}
+	return nil
+}
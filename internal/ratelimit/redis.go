@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RedisClient is the one call RedisBackend needs. It is satisfied by a thin
+// adapter over any Redis-compatible client (Redis, Valkey, KeyDB), e.g. with
+// go-redis:
+//
+//	func (a adapter) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return a.rdb.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisClient interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisBackend shares limits between instances. Each operation is one Lua
+// script, so it is atomic on the server.
+type RedisBackend struct {
+	Client RedisClient
+	Prefix string // key prefix, "ratelimit:" by default
+	// SlotTTL expires concurrency counters of crashed instances; 1h by default
+	SlotTTL time.Duration
+}
+
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+const acquireScript = `
+local n = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+if n > tonumber(ARGV[1]) then
+	redis.call('DECR', KEYS[1])
+	return 0
+end
+return 1
+`
+
+const releaseScript = `
+local n = redis.call('DECR', KEYS[1])
+if n <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return n
+`
+
+func (r *RedisBackend) key(key string) string {
+	if r.Prefix == "" {
+		return "ratelimit:" + key
+	}
+	return r.Prefix + key
+}
+
+func (r *RedisBackend) Take(key string, rate, burst, cost float64) (Decision, error) {
+	reply, err := r.Client.Eval(context.Background(), takeScript, []string{r.key("bucket:" + key)}, rate, burst, cost)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Decision{}, fmt.Errorf("unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	text, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected token count %v", values[1])
+	}
+
+	return decide(allowed == 1, tokens, rate, burst, cost), nil
+}
+
+func (r *RedisBackend) Acquire(key string, limit int) (bool, error) {
+	ttl := r.SlotTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	reply, err := r.Client.Eval(context.Background(), acquireScript, []string{r.key("slots:" + key)}, limit, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+func (r *RedisBackend) Release(key string) error {
+	_, err := r.Client.Eval(context.Background(), releaseScript, []string{r.key("slots:" + key)})
+	return err
+}
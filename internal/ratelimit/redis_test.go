@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// goRedis is the adapter described on RedisClient.
+type goRedis struct {
+	rdb *redis.Client
+}
+
+func (a goRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return a.rdb.Eval(ctx, script, keys, args...).Result()
+}
+
+// newRedisBackend runs the backend against an in-process Redis whose clock
+// starts at a fixed time.
+func newRedisBackend(t *testing.T) (*RedisBackend, *miniredis.Miniredis, time.Time) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	start := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	server.SetTime(start)
+
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return &RedisBackend{Client: goRedis{rdb}}, server, start
+}
+
+func take(t *testing.T, r *RedisBackend, key string, rate, burst, cost float64) Decision {
+	t.Helper()
+
+	d, err := r.Take(key, rate, burst, cost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRedisTakeRefills(t *testing.T) {
+	r, server, start := newRedisBackend(t)
+
+	for i := 0; i < 4; i++ {
+		if d := take(t, r, "app", 2, 4, 1); !d.Allowed || d.Remaining != int64(3-i) {
+			t.Fatalf("take %d = %+v, want allowed with %d left", i, d, 3-i)
+		}
+	}
+	d := take(t, r, "app", 2, 4, 1)
+	if d.Allowed || d.RetryAfter != time.Second || d.Limit != 4 {
+		t.Fatalf("take from an empty bucket = %+v, want denied for 1s", d)
+	}
+
+	// Half a second at 2 tokens per second brings one token back
+	server.SetTime(start.Add(500 * time.Millisecond))
+	if d := take(t, r, "app", 2, 4, 1); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("take after refill = %+v, want allowed with 0 left", d)
+	}
+	if d := take(t, r, "app", 2, 4, 1); d.Allowed {
+		t.Fatalf("second take after refill = %+v, want denied", d)
+	}
+
+	// Buckets are independent per key
+	if d := take(t, r, "other", 2, 4, 1); !d.Allowed {
+		t.Fatalf("take on another key = %+v, want allowed", d)
+	}
+}
+
+func TestRedisTakeCapsAtBurst(t *testing.T) {
+	r, server, start := newRedisBackend(t)
+
+	take(t, r, "app", 10, 5, 5)
+	server.SetTime(start.Add(time.Hour))
+	if d := take(t, r, "app", 10, 5, 1); !d.Allowed || d.Remaining != 4 {
+		t.Fatalf("take after a long idle = %+v, want 4 left of a burst of 5", d)
+	}
+
+	// A cost larger than the burst can never be served
+	if d := take(t, r, "big", 10, 5, 6); d.Allowed {
+		t.Fatalf("take above the burst = %+v, want denied", d)
+	}
+
+	// Idle buckets expire once they would have refilled
+	server.FastForward(2 * time.Second)
+	if server.Exists("ratelimit:bucket:app") {
+		t.Fatal("idle bucket was not expired")
+	}
+}
+
+func TestRedisSlots(t *testing.T) {
+	r, server, _ := newRedisBackend(t)
+
+	acquire := func(key string) bool {
+		t.Helper()
+		ok, err := r.Acquire(key, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !acquire("app") || !acquire("app") {
+		t.Fatal("could not acquire the first two slots")
+	}
+	if acquire("app") {
+		t.Fatal("acquired a third slot with a limit of 2")
+	}
+	if !acquire("other") {
+		t.Fatal("slots of another key are exhausted")
+	}
+
+	if err := r.Release("app"); err != nil {
+		t.Fatal(err)
+	}
+	if !acquire("app") {
+		t.Fatal("could not acquire a released slot")
+	}
+
+	// Releasing every slot removes the counter
+	for i := 0; i < 2; i++ {
+		if err := r.Release("app"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.Exists("ratelimit:slots:app") {
+		t.Fatal("counter left behind after every slot was released")
+	}
+}
+
+func TestRedisLeakedSlotsExpire(t *testing.T) {
+	r, server, _ := newRedisBackend(t)
+	r.SlotTTL = time.Minute
+	r.Prefix = "limits:"
+
+	// An instance that crashed while holding both slots
+	for i := 0; i < 2; i++ {
+		if ok, err := r.Acquire("app", 2); err != nil || !ok {
+			t.Fatalf("acquire %d: %v, %v", i, ok, err)
+		}
+	}
+	if !server.Exists("limits:slots:app") {
+		t.Fatal("slots not stored under the configured prefix")
+	}
+
+	server.FastForward(2 * time.Minute)
+	if ok, err := r.Acquire("app", 2); err != nil || !ok {
+		t.Fatalf("acquire after the slot TTL: %v, %v", ok, err)
+	}
+}
@@ -46,6 +46,11 @@ func NewAuditService(url string) (*AuditService, error) {
 }
 
 func (s *AuditService) LogEvent(action, details, severity string) {
+	// Sin conexión (p. ej. en tests) no hay a dónde publicar
+	if s.channel == nil {
+		return
+	}
+
 	msg := AuditMessage{
 		Timestamp: time.Now().Format(time.RFC3339),
 		Service:   "StorageService-Go",
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/compress"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlobService writes and releases stored objects. For dedup buckets objects
+// are addressed by content and reference-counted in the blobs table; for other
+// buckets it goes straight to the strategy.
+type BlobService struct {
+	DB    *gorm.DB
+	Usage *UsageService
+}
+
+func NewBlobService(db *gorm.DB) *BlobService {
+	return &BlobService{DB: db, Usage: NewUsageService(db)}
+}
+
+// StoredObject is what Put wrote, to be recorded on the FileMetadata row.
+type StoredObject struct {
+	Path        string
+	Hash        string
+	Compression string
+	StoredSize  int64
+}
+
+// Put stores data in the bucket. Content is compressed first when the bucket
+// asks for it and the content type is not already compressed; the strategy
+// then encrypts the compressed bytes if the bucket is ciphered.
+func (s *BlobService) Put(bucket model.Bucket, data []byte, physicalName string, contentType string) (StoredObject, error) {
+	strat, ok := storage.GetStrategy(bucket.ProviderType)
+	if !ok {
+		return StoredObject{}, fmt.Errorf("invalid storage provider %q", bucket.ProviderType)
+	}
+
+	hash, err := crypto.ContentKey(bucket.ID.String(), data, bucket.Cipher)
+	if err != nil {
+		return StoredObject{}, err
+	}
+
+	if bucket.Dedup {
+		if obj, err := s.reference(bucket, hash); err == nil {
+			return obj, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return StoredObject{}, err
+		}
+	}
+
+	payload, algo, err := compressFor(bucket, data, contentType)
+	if err != nil {
+		return StoredObject{}, err
+	}
+
+	obj := StoredObject{Hash: hash, Compression: algo, StoredSize: int64(len(payload))}
+
+	if !bucket.Dedup {
+		obj.Path, err = strat.Upload(bytes.NewReader(payload), physicalName, bucket.Config, bucket.Cipher)
+		return obj, err
+	}
+
+	obj.Path, err = strat.Upload(bytes.NewReader(payload), hash, bucket.Config, bucket.Cipher)
+	if err != nil {
+		return StoredObject{}, err
+	}
+
+	// Concurrent first uploads of the same content write identical bytes to the
+	// same name; the upsert makes the second one a reference.
+	blob := model.Blob{
+		ID:           uuid.New(),
+		BucketID:     bucket.ID,
+		Hash:         hash,
+		PhysicalPath: obj.Path,
+		Size:         obj.StoredSize,
+		Compression:  algo,
+		RefCount:     1,
+	}
+	err = s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bucket_id"}, {Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blobs.ref_count + 1")}),
+	}).Create(&blob).Error
+	if err != nil {
+		return StoredObject{}, err
+	}
+
+	return obj, nil
+}
+
+// reference adds a reference to an existing blob. The row lock serialises it
+// with Release, so a blob being garbage-collected is never handed out again.
+func (s *BlobService) reference(bucket model.Bucket, hash string) (StoredObject, error) {
+	var blob model.Blob
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_id = ? AND hash = ?", bucket.ID, hash).
+			First(&blob).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count + 1")).Error
+	})
+	if err != nil {
+		return StoredObject{}, err
+	}
+
+	return StoredObject{Path: blob.PhysicalPath, Hash: hash, Compression: blob.Compression, StoredSize: blob.Size}, nil
+}
+
+// compressFor applies the bucket's compression unless the content type is
+// already compressed or compressing would not make the payload smaller.
+func compressFor(bucket model.Bucket, data []byte, contentType string) ([]byte, string, error) {
+	if bucket.Compression == compress.None || compress.ShouldSkip(contentType) {
+		return data, compress.None, nil
+	}
+
+	packed, err := compress.Compress(bucket.Compression, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(packed) >= len(data) {
+		return data, compress.None, nil
+	}
+	return packed, bucket.Compression, nil
+}
+
+// Read downloads an object, decrypts it when the bucket is ciphered and
+// reverses the compression recorded for the file.
+func (s *BlobService) Read(bucket model.Bucket, physicalPath string, compression string) ([]byte, error) {
+	strat, ok := storage.GetStrategy(bucket.ProviderType)
+	if !ok {
+		return nil, fmt.Errorf("invalid storage provider %q", bucket.ProviderType)
+	}
+
+	reader, err := strat.Download(physicalPath, bucket.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket.Cipher {
+		data, err = crypto.Decrypt(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compress.Decompress(compression, data)
+}
+
+// Release drops one reference to a stored object. Blobs are deleted only when
+// their last reference goes away, even if the bucket has since left dedup mode.
+func (s *BlobService) Release(bucket model.Bucket, physicalPath, hash string) error {
+	strat, ok := storage.GetStrategy(bucket.ProviderType)
+	if !ok {
+		return fmt.Errorf("invalid storage provider %q", bucket.ProviderType)
+	}
+
+	if hash == "" {
+		return strat.Delete(physicalPath, bucket.Config)
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var blob model.Blob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_id = ? AND hash = ?", bucket.ID, hash).
+			First(&blob).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Not a blob: stored outside dedup mode.
+			return strat.Delete(physicalPath, bucket.Config)
+		}
+		if err != nil {
+			return err
+		}
+		if blob.PhysicalPath != physicalPath {
+			// Same content, but this copy was written outside the blob table.
+			return strat.Delete(physicalPath, bucket.Config)
+		}
+
+		if blob.RefCount > 1 {
+			return tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count - 1")).Error
+		}
+
+		if err := strat.Delete(blob.PhysicalPath, bucket.Config); err != nil {
+			return err
+		}
+		return tx.Delete(&blob).Error
+	})
+}
+
+// Destroy physically deletes a file row: its archived versions, its stored
+// object and the row itself, bypassing soft delete. file.Bucket must be loaded.
+func (s *BlobService) Destroy(file model.FileMetadata) error {
+	var versions []model.FileVersion
+	s.DB.Where("file_id = ?", file.ID).Find(&versions)
+
+	for _, v := range versions {
+		if err := s.Release(file.Bucket, v.PhysicalPath, v.ContentHash); err != nil {
+			return fmt.Errorf("version %d: %w", v.Version, err)
+		}
+		s.DB.Delete(&model.FileVersion{}, "id = ?", v.ID)
+		s.Usage.Add(file.BucketID, file.AppID, -v.FileSize, 0)
+		s.Usage.Record(VersionUsage(file, v, -1))
+	}
+
+	if err := s.Release(file.Bucket, file.PhysicalPath, file.ContentHash); err != nil {
+		return err
+	}
+
+	if err := s.DB.Unscoped().Delete(&model.FileMetadata{}, "id = ?", file.ID).Error; err != nil {
+		return err
+	}
+	s.Usage.Record(FileUsage(file, -1))
+	return s.Usage.Add(file.BucketID, file.AppID, -file.FileSize, -1)
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/client"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// lastUsedResolution limits last_used_at writes to one per credential and
+// minute instead of one per request.
+const lastUsedResolution = time.Minute
+
+var ErrInvalidCredential = errors.New("invalid API credential")
+
+// CredentialService issues, rotates and checks the API credentials of apps.
+type CredentialService struct {
+	DB *gorm.DB
+}
+
+func NewCredentialService(db *gorm.DB) *CredentialService {
+	return &CredentialService{DB: db}
+}
+
+// Issue creates a credential from a template holding the app, label, expiry
+// and scope. The returned credential carries the plaintext secret; only its
+// hash is stored.
+func (s *CredentialService) Issue(tx *gorm.DB, template model.ApiCredential) (model.ApiCredential, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return model.ApiCredential{}, err
+	}
+	key, err := randomToken(16)
+	if err != nil {
+		return model.ApiCredential{}, err
+	}
+	hash, err := crypto.HashSecret(secret)
+	if err != nil {
+		return model.ApiCredential{}, err
+	}
+
+	credential := model.ApiCredential{
+		ID:          uuid.New(),
+		AppID:       template.AppID,
+		ApiKey:      key,
+		SecretHash:  hash,
+		Label:       template.Label,
+		Buckets:     template.Buckets,
+		Permissions: template.Permissions,
+		ExpiresAt:   template.ExpiresAt,
+	}
+
+	// Signed requests need the derived key at the server; without a master
+	// key the credential still works with X-API-Secret
+	if sealed, err := crypto.Encrypt(client.DeriveSigningKey(secret)); err == nil {
+		credential.SigningKey = sealed
+	} else {
+		log.Printf("Warning: credential %s issued without a request-signing key: %v", key, err)
+	}
+	if err := tx.Create(&credential).Error; err != nil {
+		return model.ApiCredential{}, err
+	}
+
+	credential.ApiSecret = secret
+	return credential, nil
+}
+
+// Rotate issues a new credential and lets every other valid credential of the
+// app expire after grace, so clients can switch over without downtime.
+// Credentials already expiring sooner keep their expiry.
+func (s *CredentialService) Rotate(template model.ApiCredential, grace time.Duration) (model.ApiCredential, error) {
+	appID := template.AppID
+	var credential model.ApiCredential
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		cutoff := time.Now().Add(grace)
+		err := tx.Model(&model.ApiCredential{}).
+			Where("app_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", appID, cutoff).
+			Update("expires_at", cutoff).Error
+		if err != nil {
+			return err
+		}
+
+		credential, err = s.Issue(tx, template)
+		return err
+	})
+	return credential, err
+}
+
+// Revoke disables a credential immediately, with the share links it issued.
+func (s *CredentialService) Revoke(appID, credentialID uuid.UUID) error {
+	return s.revoke(&model.ApiCredential{}, appID, credentialID)
+}
+
+// RevokeCertificate disables a client certificate mapping immediately, with
+// the share links issued through it.
+func (s *CredentialService) RevokeCertificate(appID, certificateID uuid.UUID) error {
+	return s.revoke(&model.ClientCertificate{}, appID, certificateID)
+}
+
+func (s *CredentialService) revoke(table interface{}, appID, id uuid.UUID) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(table).
+			Where("id = ? AND app_id = ? AND revoked_at IS NULL", id, appID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("credential_id = ? AND app_id = ?", id, appID).Delete(&model.ShareLink{}).Error
+	})
+}
+
+// Authenticate returns the credential matching key and secret if it is
+// neither revoked nor expired, and records that it was used.
+func (s *CredentialService) Authenticate(key, secret string) (model.ApiCredential, error) {
+	credential, err := s.find(key)
+	if err != nil || !crypto.VerifySecret(secret, credential.SecretHash) {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+
+	s.touch(credential)
+	return credential, nil
+}
+
+// AuthenticateSigned returns the credential for key if verify accepts the
+// request with its signing key, and records that it was used.
+func (s *CredentialService) AuthenticateSigned(key string, verify func(signingKey []byte) bool) (model.ApiCredential, error) {
+	credential, err := s.find(key)
+	if err != nil || len(credential.SigningKey) == 0 {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+
+	signingKey, err := crypto.Decrypt(credential.SigningKey)
+	if err != nil || !verify(signingKey) {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+
+	s.touch(credential)
+	return credential, nil
+}
+
+func (s *CredentialService) find(key string) (model.ApiCredential, error) {
+	var credential model.ApiCredential
+	if err := s.DB.Where("api_key = ?", key).First(&credential).Error; err != nil {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+	if !credential.Valid(time.Now()) {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+	return credential, nil
+}
+
+func (s *CredentialService) touch(credential model.ApiCredential) {
+	now := time.Now()
+	s.DB.Model(&model.ApiCredential{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", credential.ID, now.Add(-lastUsedResolution)).
+		UpdateColumn("last_used_at", now)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CertificateFingerprint is the hex SHA-256 of a certificate, as stored in
+// ClientCertificate.Fingerprint.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateCertificate returns the credential of the app a verified client
+// certificate is mapped to. A fingerprint mapping wins over a subject one; a
+// subject mapped to several apps authenticates nobody.
+func (s *CredentialService) AuthenticateCertificate(cert *x509.Certificate) (model.ApiCredential, error) {
+	var mappings []model.ClientCertificate
+	s.DB.Where("revoked_at IS NULL AND fingerprint = ?", CertificateFingerprint(cert)).Find(&mappings)
+	if len(mappings) == 0 {
+		s.DB.Where("revoked_at IS NULL AND subject = ?", cert.Subject.String()).Find(&mappings)
+	}
+	if len(mappings) != 1 {
+		return model.ApiCredential{}, ErrInvalidCredential
+	}
+	return mappings[0].Credential(), nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"gorm.io/gorm"
+)
+
+// ExpiryService deletes files whose time-to-live has passed, together with
+// their replicas and versions. Files under legal hold or retention are kept
+// until the lock is lifted.
+type ExpiryService struct {
+	DB    *gorm.DB
+	Blobs *BlobService
+	Audit *AuditService
+}
+
+func NewExpiryService(db *gorm.DB, audit *AuditService) *ExpiryService {
+	return &ExpiryService{
+		DB:    db,
+		Blobs: NewBlobService(db),
+		Audit: audit,
+	}
+}
+
+// Run reaps expired files every interval until ctx is cancelled.
+func (s *ExpiryService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.ReapExpired()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReapExpired deletes every expired, unlocked file (trashed ones included),
+// expired share links and abandoned direct uploads, and returns how many files
+// were removed.
+func (s *ExpiryService) ReapExpired() int {
+	now := time.Now()
+
+	var expired []model.FileMetadata
+	s.DB.Unscoped().
+		Where("expires_at IS NOT NULL AND expires_at <= ? AND replica_of IS NULL", now).
+		Find(&expired)
+
+	reaped := 0
+	for _, primary := range expired {
+		var copies []model.FileMetadata
+		s.DB.Unscoped().Preload("Bucket").
+			Where("id = ? OR replica_of = ?", primary.ID, primary.ID).
+			Order("replica_of IS NULL").
+			Find(&copies)
+
+		if err := CheckLocks(copies, false, now); err != nil {
+			continue
+		}
+
+		failed := false
+		for _, file := range copies {
+			if err := s.Blobs.Destroy(file); err != nil {
+				s.Audit.LogEvent("FILE_EXPIRY_ERROR",
+					fmt.Sprintf("Failed to delete expired file %s from bucket %s: %v", file.ID, file.Bucket.Name, err), "ERROR")
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+
+		reaped++
+		s.Audit.LogEvent("FILE_EXPIRED",
+			fmt.Sprintf("File %s (%s) expired at %s and was deleted with %d copies",
+				primary.ID, primary.OriginalName, primary.ExpiresAt.UTC().Format(time.RFC3339), len(copies)), "INFO")
+	}
+
+	// Expired share links only keep their download counters
+	NewShareService(s.DB).PurgeExpired(now)
+	NewPresignService(s.DB).PurgeAbandoned(now)
+
+	return reaped
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	LifecycleTransition = "TRANSITION"
+	LifecycleDelete     = "DELETE"
+
+	LifecycleBasisCreated    = "CREATED"
+	LifecycleBasisLastAccess = "LAST_ACCESS"
+
+	// lifecycleBatchSize bounds the work done per rule and run.
+	lifecycleBatchSize = 500
+)
+
+// LifecycleService evaluates lifecycle rules: it moves old files to cheaper
+// buckets or deletes them. Moved files keep their ID, so clients never see
+// the change.
+type LifecycleService struct {
+	DB    *gorm.DB
+	Blobs *BlobService
+	Audit *AuditService
+}
+
+func NewLifecycleService(db *gorm.DB, audit *AuditService) *LifecycleService {
+	return &LifecycleService{
+		DB:    db,
+		Blobs: NewBlobService(db),
+		Audit: audit,
+	}
+}
+
+// Run applies all active rules every interval until ctx is cancelled.
+func (s *LifecycleService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.ApplyRules()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyRules evaluates every active rule once and returns how many files
+// were moved or deleted.
+func (s *LifecycleService) ApplyRules() int {
+	var rules []model.LifecycleRule
+	s.DB.Preload("Bucket").Preload("TargetBucket").Where("active = ?", true).Find(&rules)
+
+	processed := 0
+	for _, rule := range rules {
+		processed += s.applyRule(rule)
+	}
+	return processed
+}
+
+func (s *LifecycleService) applyRule(rule model.LifecycleRule) int {
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, -rule.AfterDays)
+
+	query := s.DB.Where("bucket_id = ?", rule.BucketID)
+	if rule.Basis == LifecycleBasisLastAccess {
+		query = query.Where("COALESCE(last_accessed_at, created_at) < ?", cutoff)
+	} else {
+		query = query.Where("created_at < ?", cutoff)
+	}
+	if rule.Action == LifecycleDelete {
+		// Locked files wait for their hold or retention to end. Left in, they
+		// would fill every batch and keep the rest of the bucket from expiring.
+		// Moves keep the row and its lock, so transitions take locked files too.
+		query = query.
+			Where("legal_hold = ? AND (retain_until IS NULL OR retain_until < ?)", false, now).
+			Where(`NOT EXISTS (SELECT 1 FROM file_metadata AS copies WHERE copies.replica_of = file_metadata.id
+				AND copies.deleted_at IS NULL AND (copies.legal_hold = ? OR copies.retain_until >= ?))`, true, now)
+	}
+
+	var files []model.FileMetadata
+	query.Order("created_at, id").Limit(lifecycleBatchSize).Find(&files)
+
+	processed := 0
+	for _, file := range files {
+		file.Bucket = rule.Bucket
+
+		var err error
+		switch rule.Action {
+		case LifecycleTransition:
+			if rule.TargetBucket == nil {
+				return processed
+			}
+			err = s.transition(file, *rule.TargetBucket)
+		case LifecycleDelete:
+			err = s.delete(file)
+		default:
+			return processed
+		}
+
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			continue
+		}
+		if err != nil {
+			s.Audit.LogEvent("LIFECYCLE_ERROR",
+				fmt.Sprintf("Rule %s could not %s file %s: %v", rule.ID, rule.Action, file.ID, err), "ERROR")
+			continue
+		}
+		processed++
+	}
+
+	return processed
+}
+
+// transition copies the current content and every archived version of a file
+// into the target bucket, repoints the row and releases the old objects.
+func (s *LifecycleService) transition(file model.FileMetadata, target model.Bucket) error {
+	data, err := s.Blobs.Read(file.Bucket, file.PhysicalPath, file.Compression)
+	if err != nil {
+		return err
+	}
+
+	// Names come from the row, not the old path: in a dedup source the path is
+	// the content hash, shared by every file with the same content
+	stored, err := s.Blobs.Put(target, data, file.ID.String()+filepath.Ext(file.OriginalName), file.ContentType)
+	if err != nil {
+		return err
+	}
+
+	var versions []model.FileVersion
+	s.DB.Where("file_id = ?", file.ID).Find(&versions)
+
+	movedVersions := make(map[int]StoredObject, len(versions))
+	for _, v := range versions {
+		vData, err := s.Blobs.Read(file.Bucket, v.PhysicalPath, v.Compression)
+		if err == nil {
+			name := fmt.Sprintf("%s.v%d%s", file.ID, v.Version, filepath.Ext(v.OriginalName))
+			movedVersions[v.Version], err = s.Blobs.Put(target, vData, name, v.ContentType)
+		}
+		if err != nil {
+			// Undo what was already written to the target
+			s.Blobs.Release(target, stored.Path, stored.Hash)
+			for _, moved := range movedVersions {
+				s.Blobs.Release(target, moved.Path, moved.Hash)
+			}
+			return fmt.Errorf("version %d: %w", v.Version, err)
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, v := range versions {
+			moved := movedVersions[v.Version]
+			err := tx.Model(&model.FileVersion{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+				"physical_path": moved.Path,
+				"stored_size":   moved.StoredSize,
+				"compression":   moved.Compression,
+				"content_hash":  moved.Hash,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&model.FileMetadata{}).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+			"bucket_id":     target.ID,
+			"physical_path": stored.Path,
+			"stored_size":   stored.StoredSize,
+			"compression":   stored.Compression,
+			"content_hash":  stored.Hash,
+		}).Error
+	})
+	if err != nil {
+		s.Blobs.Release(target, stored.Path, stored.Hash)
+		for _, moved := range movedVersions {
+			s.Blobs.Release(target, moved.Path, moved.Hash)
+		}
+		return err
+	}
+
+	// Moves are admin-configured, so they shift usage without quota checks
+	moved := file.FileSize
+	for _, v := range versions {
+		moved += v.FileSize
+	}
+	s.Blobs.Usage.Add(file.BucketID, file.AppID, -moved, -1)
+	s.Blobs.Usage.Add(target.ID, target.AppID, moved, 1)
+
+	s.Blobs.Usage.Record(FileUsage(file, -1))
+	movedFile := file
+	movedFile.BucketID, movedFile.StoredSize = target.ID, stored.StoredSize
+	s.Blobs.Usage.Record(FileUsage(movedFile, 1))
+	for _, v := range versions {
+		s.Blobs.Usage.Record(VersionUsage(file, v, -1))
+		movedVersion := v
+		movedVersion.StoredSize = movedVersions[v.Version].StoredSize
+		s.Blobs.Usage.Record(VersionUsage(movedFile, movedVersion, 1))
+	}
+
+	// The row now points at the target; old objects are no longer referenced
+	for _, v := range versions {
+		s.Blobs.Release(file.Bucket, v.PhysicalPath, v.ContentHash)
+	}
+	s.Blobs.Release(file.Bucket, file.PhysicalPath, file.ContentHash)
+
+	s.Audit.LogEvent("FILE_LIFECYCLE_TRANSITION",
+		fmt.Sprintf("File %s moved from bucket %s to bucket %s", file.ID, file.Bucket.Name, target.Name), "INFO")
+	return nil
+}
+
+// delete removes a file once it is unlocked, or returns a *LockedError.
+// Deleting a primary removes its replicas too; a replica row in the bucket is
+// removed on its own.
+func (s *LifecycleService) delete(file model.FileMetadata) error {
+	var copies []model.FileMetadata
+	if file.ReplicaOf == nil {
+		s.DB.Preload("Bucket").
+			Where("id = ? OR replica_of = ?", file.ID, file.ID).
+			Order("replica_of IS NULL").
+			Find(&copies)
+	} else {
+		copies = []model.FileMetadata{file}
+	}
+
+	if err := CheckLocks(copies, false, time.Now()); err != nil {
+		// Locked since it was selected; it waits for its hold or retention to end
+		return err
+	}
+
+	for _, c := range copies {
+		if err := s.Blobs.Destroy(c); err != nil {
+			return err
+		}
+	}
+
+	s.Audit.LogEvent("FILE_LIFECYCLE_DELETE",
+		fmt.Sprintf("File %s (%s) deleted by lifecycle rule of bucket %s", file.ID, file.OriginalName, file.Bucket.Name), "INFO")
+	return nil
+}
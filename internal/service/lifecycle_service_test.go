@@ -0,0 +1,149 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestLifecycleDeleteSkipsLockedFiles(t *testing.T) {
+	db := newTestDB(t)
+	bucket := newMemoryBucket(t, db, "records")
+	replicas := newMemoryBucket(t, db, "replicas")
+
+	old := time.Now().AddDate(0, 0, -30)
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	file := func(name string, mutate func(*model.FileMetadata)) model.FileMetadata {
+		f := model.FileMetadata{
+			ID:           uuid.New(),
+			AppID:        bucket.AppID,
+			BucketID:     bucket.ID,
+			OriginalName: name,
+			PhysicalPath: name,
+			FileSize:     1,
+			CreatedAt:    old,
+		}
+		if mutate != nil {
+			mutate(&f)
+		}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	held := file("held", func(f *model.FileMetadata) { f.LegalHold = true })
+	retained := file("retained", func(f *model.FileMetadata) {
+		f.RetentionMode, f.RetainUntil = RetentionCompliance, &future
+	})
+	replicated := file("replicated", nil)
+	file("replica", func(f *model.FileMetadata) {
+		f.BucketID, f.ReplicaOf = replicas.ID, &replicated.ID
+		f.RetentionMode, f.RetainUntil = RetentionGovernance, &future
+	})
+	expiredRetention := file("expired-retention", func(f *model.FileMetadata) {
+		f.RetentionMode, f.RetainUntil = RetentionGovernance, &past
+	})
+	free := file("free", nil)
+	recent := file("recent", func(f *model.FileMetadata) { f.CreatedAt = time.Now() })
+
+	rule := model.LifecycleRule{ID: uuid.New(), AppID: bucket.AppID, BucketID: bucket.ID, Action: LifecycleDelete, AfterDays: 7, Active: true}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	lifecycle := NewLifecycleService(db, &AuditService{})
+	if got := lifecycle.ApplyRules(); got != 2 {
+		t.Fatalf("first run processed %d files, want the 2 unlocked old files", got)
+	}
+	if got := lifecycle.ApplyRules(); got != 0 {
+		t.Fatalf("second run processed %d files, want 0: locked files must not count", got)
+	}
+
+	remaining := map[uuid.UUID]bool{}
+	var rows []model.FileMetadata
+	db.Unscoped().Where("bucket_id = ?", bucket.ID).Find(&rows)
+	for _, r := range rows {
+		remaining[r.ID] = true
+	}
+	for _, f := range []model.FileMetadata{held, retained, replicated, recent} {
+		if !remaining[f.ID] {
+			t.Errorf("file %s was deleted", f.OriginalName)
+		}
+	}
+	for _, f := range []model.FileMetadata{expiredRetention, free} {
+		if remaining[f.ID] {
+			t.Errorf("file %s was kept", f.OriginalName)
+		}
+	}
+}
+
+func TestLifecycleTransitionOutOfDedupKeepsFilesApart(t *testing.T) {
+	db := newTestDB(t)
+	source := newMemoryBucket(t, db, "dedup")
+	db.Model(&source).Update("dedup", true)
+	source.Dedup = true
+	target := model.Bucket{ID: uuid.New(), AppID: source.AppID, Name: "archive", ProviderType: "MEMORY", Config: `{"namespace":"` + uuid.NewString() + `"}`}
+	if err := db.Create(&target).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := NewBlobService(db)
+	content := []byte("same scan, two patients")
+	old := time.Now().AddDate(0, 0, -30)
+
+	var files []model.FileMetadata
+	for _, name := range []string{"first.dcm", "second.dcm"} {
+		stored, err := blobs.Put(source, content, name, "application/dicom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := model.FileMetadata{ID: uuid.New(), AppID: source.AppID, BucketID: source.ID, OriginalName: name,
+			PhysicalPath: stored.Path, ContentHash: stored.Hash, FileSize: int64(len(content)), Version: 2, CreatedAt: old}
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatal(err)
+		}
+		// An archived version with the same content, also deduplicated
+		v, err := blobs.Put(source, content, name, "application/dicom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Create(&model.FileVersion{ID: uuid.New(), FileID: f.ID, Version: 1, OriginalName: name, PhysicalPath: v.Path, ContentHash: v.Hash})
+		files = append(files, f)
+	}
+	if files[0].PhysicalPath != files[1].PhysicalPath {
+		t.Fatal("the dedup source did not share the object")
+	}
+
+	rule := model.LifecycleRule{ID: uuid.New(), AppID: source.AppID, BucketID: source.ID, Action: LifecycleTransition, AfterDays: 7, TargetBucketID: &target.ID, Active: true}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := NewLifecycleService(db, &AuditService{}).ApplyRules(); got != 2 {
+		t.Fatalf("moved %d files, want 2", got)
+	}
+
+	var moved []model.FileMetadata
+	db.Preload("Bucket").Where("id IN ?", []uuid.UUID{files[0].ID, files[1].ID}).Find(&moved)
+	if len(moved) != 2 || moved[0].BucketID != target.ID || moved[0].PhysicalPath == moved[1].PhysicalPath {
+		t.Fatalf("moved files = %+v, want two objects in the target", moved)
+	}
+
+	// Deleting one file leaves the other's current and archived content
+	if err := blobs.Destroy(moved[0]); err != nil {
+		t.Fatal(err)
+	}
+	survivor := moved[1]
+	if data, err := blobs.Read(target, survivor.PhysicalPath, survivor.Compression); err != nil || string(data) != string(content) {
+		t.Fatalf("surviving file: %q, %v", data, err)
+	}
+	var version model.FileVersion
+	db.First(&version, "file_id = ?", survivor.ID)
+	if data, err := blobs.Read(target, version.PhysicalPath, version.Compression); err != nil || string(data) != string(content) {
+		t.Fatalf("surviving version: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/JAreyes98/healthconnect-storage-service/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// abandonedUploadGrace is how long after its URL expired a pending upload is
+// kept, since a transfer that started in time may still be running.
+const abandonedUploadGrace = 24 * time.Hour
+
+var (
+	ErrDirectTransfer = errors.New("direct transfer not available")
+	ErrUploadNotFound = errors.New("pending upload not found")
+	ErrUploadMismatch = errors.New("uploaded object does not match the presigned upload")
+)
+
+// PresignService lets clients move content straight to and from the
+// provider with presigned URLs. Only buckets whose objects are stored exactly
+// as sent qualify: encryption, compression and deduplication all need the
+// service to see the bytes, and so do replication rules.
+type PresignService struct {
+	DB    *gorm.DB
+	Usage *UsageService
+}
+
+func NewPresignService(db *gorm.DB) *PresignService {
+	return &PresignService{DB: db, Usage: NewUsageService(db)}
+}
+
+// directTransferRefusal explains why bucket cannot be written or read
+// directly, or returns "".
+func directTransferRefusal(bucket model.Bucket) string {
+	switch {
+	case bucket.Cipher:
+		return "bucket is encrypted"
+	case bucket.Dedup:
+		return "bucket deduplicates content"
+	case bucket.Compression != "":
+		return "bucket compresses content"
+	}
+	if _, ok := presigner(bucket); !ok {
+		return fmt.Sprintf("provider %s cannot presign requests", bucket.ProviderType)
+	}
+	return ""
+}
+
+func presigner(bucket model.Bucket) (storage.Presigner, bool) {
+	strat, ok := storage.GetStrategy(bucket.ProviderType)
+	if !ok {
+		return nil, false
+	}
+	p, ok := strat.(storage.Presigner)
+	return p, ok
+}
+
+// BeginUpload presigns a PUT for a new file and records it as pending.
+func (s *PresignService) BeginUpload(upload model.PendingUpload, ttl time.Duration) (model.PendingUpload, storage.PresignedRequest, error) {
+	bucket := upload.Bucket
+	if reason := directTransferRefusal(bucket); reason != "" {
+		return upload, storage.PresignedRequest{}, fmt.Errorf("%w: %s", ErrDirectTransfer, reason)
+	}
+
+	var rules int64
+	s.DB.Model(&model.ReplicationRule{}).Where("source_bucket_id = ? AND active = ?", bucket.ID, true).Count(&rules)
+	if rules > 0 {
+		return upload, storage.PresignedRequest{}, fmt.Errorf("%w: bucket is replicated", ErrDirectTransfer)
+	}
+
+	if bucket.MaxFileSize > 0 && upload.Size > bucket.MaxFileSize {
+		return upload, storage.PresignedRequest{}, &QuotaError{Scope: "bucket", Name: bucket.Name,
+			Reason: fmt.Sprintf("file of %d bytes exceeds the %d byte limit", upload.Size, bucket.MaxFileSize), TooLarge: true}
+	}
+
+	p, _ := presigner(bucket)
+	upload.ID = uuid.New()
+	req, err := p.PresignPut(upload.ID.String()+filepath.Ext(upload.OriginalName), bucket.Config, upload.ContentType, upload.Size, ttl)
+	if err != nil {
+		return upload, storage.PresignedRequest{}, err
+	}
+
+	upload.PhysicalPath = req.Path
+	upload.UploadExpiresAt = req.ExpiresAt
+	if err := s.DB.Omit("Bucket").Create(&upload).Error; err != nil {
+		return upload, storage.PresignedRequest{}, err
+	}
+	return upload, req, nil
+}
+
+// CompleteUpload checks the uploaded object with Stat and turns the pending
+// upload into a file. Objects that do not match, or do not fit the quota, are
+// deleted.
+func (s *PresignService) CompleteUpload(appID, uploadID uuid.UUID) (model.FileMetadata, error) {
+	var upload model.PendingUpload
+	if err := s.DB.Preload("Bucket").Where("id = ? AND app_id = ?", uploadID, appID).First(&upload).Error; err != nil {
+		return model.FileMetadata{}, ErrUploadNotFound
+	}
+
+	strat, _ := storage.GetStrategy(upload.Bucket.ProviderType)
+	stater, ok := strat.(storage.Stater)
+	if !ok {
+		return model.FileMetadata{}, fmt.Errorf("%w: provider %s cannot verify objects", ErrDirectTransfer, upload.Bucket.ProviderType)
+	}
+
+	info, err := stater.Stat(upload.PhysicalPath, upload.Bucket.Config)
+	if err != nil {
+		return model.FileMetadata{}, fmt.Errorf("%w: object not found", ErrUploadMismatch)
+	}
+	if info.Size != upload.Size {
+		s.discard(upload)
+		return model.FileMetadata{}, fmt.Errorf("%w: %d bytes stored, %d announced", ErrUploadMismatch, info.Size, upload.Size)
+	}
+
+	if err := s.Usage.Reserve(upload.Bucket, upload.Size, 1); err != nil {
+		s.discard(upload)
+		return model.FileMetadata{}, err
+	}
+
+	retentionMode, retainUntil := DefaultRetention(upload.Bucket, time.Now())
+	file := model.FileMetadata{
+		ID:            upload.ID,
+		AppID:         upload.AppID,
+		BucketID:      upload.BucketID,
+		OriginalName:  upload.OriginalName,
+		PhysicalPath:  upload.PhysicalPath,
+		FileSize:      upload.Size,
+		StoredSize:    upload.Size,
+		ContentType:   upload.ContentType,
+		Version:       1,
+		RetentionMode: retentionMode,
+		RetainUntil:   retainUntil,
+		ExpiresAt:     upload.FileExpiresAt,
+	}
+
+	// Deleting the pending row claims it, so concurrent completions create
+	// the file once
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.PendingUpload{}, "id = ?", upload.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUploadNotFound
+		}
+		return tx.Create(&file).Error
+	})
+	if err != nil {
+		s.Usage.Add(upload.BucketID, upload.AppID, -upload.Size, -1)
+		return model.FileMetadata{}, err
+	}
+
+	s.Usage.Record(FileUsage(file, 1))
+	return file, nil
+}
+
+// PresignDownload presigns a GET for a file stored exactly as uploaded. Only
+// the stored form matters here, so deduplicated files qualify.
+func (s *PresignService) PresignDownload(file model.FileMetadata, ttl time.Duration) (storage.PresignedRequest, error) {
+	switch {
+	case file.Bucket.Cipher:
+		return storage.PresignedRequest{}, fmt.Errorf("%w: file is encrypted", ErrDirectTransfer)
+	case file.Compression != "":
+		return storage.PresignedRequest{}, fmt.Errorf("%w: file is compressed", ErrDirectTransfer)
+	}
+
+	p, ok := presigner(file.Bucket)
+	if !ok {
+		return storage.PresignedRequest{}, fmt.Errorf("%w: provider %s cannot presign requests", ErrDirectTransfer, file.Bucket.ProviderType)
+	}
+	return p.PresignGet(file.PhysicalPath, file.Bucket.Config, ttl)
+}
+
+// PurgeAbandoned deletes pending uploads that were never completed, with
+// whatever the client managed to store.
+func (s *PresignService) PurgeAbandoned(now time.Time) int {
+	var uploads []model.PendingUpload
+	s.DB.Preload("Bucket").Where("upload_expires_at <= ?", now.Add(-abandonedUploadGrace)).Find(&uploads)
+
+	for _, upload := range uploads {
+		s.discard(upload)
+	}
+	return len(uploads)
+}
+
+// discard deletes a pending upload and its object. upload.Bucket must be
+// loaded.
+func (s *PresignService) discard(upload model.PendingUpload) {
+	if strat, ok := storage.GetStrategy(upload.Bucket.ProviderType); ok {
+		strat.Delete(upload.PhysicalPath, upload.Bucket.Config)
+	}
+	s.DB.Delete(&model.PendingUpload{}, "id = ?", upload.ID)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+)
+
+const (
+	// RetentionGovernance blocks deletion unless the caller explicitly
+	// bypasses governance retention.
+	RetentionGovernance = "GOVERNANCE"
+	// RetentionCompliance blocks deletion for everyone until it expires, and
+	// the retain-until date can only be extended.
+	RetentionCompliance = "COMPLIANCE"
+)
+
+// ValidRetentionMode reports whether mode is a supported retention mode.
+// The empty mode means no retention.
+func ValidRetentionMode(mode string) bool {
+	return mode == "" || mode == RetentionGovernance || mode == RetentionCompliance
+}
+
+// LockedError explains why a file cannot be deleted or overwritten.
+type LockedError struct {
+	FileID string
+	Reason string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("file %s is locked: %s", e.FileID, e.Reason)
+}
+
+// CheckLock returns a *LockedError when the file is under legal hold or an
+// active retention period. Governance retention can be bypassed.
+func CheckLock(file model.FileMetadata, bypassGovernance bool, now time.Time) error {
+	if file.LegalHold {
+		return &LockedError{FileID: file.ID.String(), Reason: "legal hold is active"}
+	}
+
+	if file.RetainUntil == nil || !now.Before(*file.RetainUntil) {
+		return nil
+	}
+
+	until := file.RetainUntil.UTC().Format(time.RFC3339)
+	switch file.RetentionMode {
+	case RetentionCompliance:
+		return &LockedError{FileID: file.ID.String(), Reason: "compliance retention until " + until}
+	case RetentionGovernance:
+		if bypassGovernance {
+			return nil
+		}
+		return &LockedError{FileID: file.ID.String(), Reason: "governance retention until " + until}
+	}
+	return nil
+}
+
+// CheckLocks applies CheckLock to every copy of a file (primary and replicas).
+func CheckLocks(files []model.FileMetadata, bypassGovernance bool, now time.Time) error {
+	for _, f := range files {
+		if err := CheckLock(f, bypassGovernance, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultRetention returns the retention a new file in the bucket starts with.
+func DefaultRetention(bucket model.Bucket, now time.Time) (string, *time.Time) {
+	if bucket.RetentionMode == "" || bucket.RetentionDays <= 0 {
+		return "", nil
+	}
+	until := now.AddDate(0, 0, bucket.RetentionDays)
+	return bucket.RetentionMode, &until
+}
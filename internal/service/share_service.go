@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+
+	// shareKeyPurpose separates the share-link key from other derived keys
+	shareKeyPurpose = "share-links-v1"
+)
+
+var (
+	ErrShareInvalid   = errors.New("invalid share link")
+	ErrShareExpired   = errors.New("share link expired")
+	ErrShareIP        = errors.New("share link not valid from this address")
+	ErrShareExhausted = errors.New("share link download limit reached")
+	ErrShareRevoked   = errors.New("share link revoked with the credential that issued it")
+	ErrShareFileGone  = errors.New("shared file no longer exists")
+)
+
+// shareClaims are the signed terms carried in a share token.
+type shareClaims struct {
+	LinkID      uuid.UUID `json:"lid"`
+	FileID      uuid.UUID `json:"fid"`
+	ExpiresAt   int64     `json:"exp"`
+	AllowedIP   string    `json:"ip,omitempty"`
+	Disposition string    `json:"dsp"`
+}
+
+// ShareService mints and redeems signed share links. Tokens are
+// base64url(claims) "." base64url(HMAC-SHA256(key, claims)), with the key
+// derived from STORAGE_CIPHER_KEY, so links can be checked before touching
+// the database and cannot be forged or altered.
+type ShareService struct {
+	DB *gorm.DB
+}
+
+func NewShareService(db *gorm.DB) *ShareService {
+	return &ShareService{DB: db}
+}
+
+// ValidAllowedIP reports whether value is empty, an IP or a CIDR.
+func ValidAllowedIP(value string) bool {
+	if value == "" || net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
+
+// Create stores link and returns its token.
+func (s *ShareService) Create(link *model.ShareLink) (string, error) {
+	link.ID = uuid.New()
+
+	token, err := signShare(shareClaims{
+		LinkID:      link.ID,
+		FileID:      link.FileID,
+		ExpiresAt:   link.ExpiresAt.Unix(),
+		AllowedIP:   link.AllowedIP,
+		Disposition: link.Disposition,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.DB.Create(link).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Open checks a token for a request from ip and counts the download. Links
+// die with the credential that issued them. When the link is refused it is
+// still returned as far as it is known, so the refusal can be audited.
+func (s *ShareService) Open(token, ip string, now time.Time) (model.ShareLink, error) {
+	claims, err := verifyShare(token)
+	if err != nil {
+		return model.ShareLink{}, err
+	}
+
+	link := model.ShareLink{
+		ID:          claims.LinkID,
+		FileID:      claims.FileID,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+		AllowedIP:   claims.AllowedIP,
+		Disposition: claims.Disposition,
+	}
+	if !now.Before(link.ExpiresAt) {
+		return link, ErrShareExpired
+	}
+	if !ipAllowed(claims.AllowedIP, ip) {
+		return link, ErrShareIP
+	}
+
+	var stored model.ShareLink
+	if err := s.DB.First(&stored, "id = ?", link.ID).Error; err != nil {
+		return link, ErrShareInvalid // link purged after expiry or deleted with its credential
+	}
+	link.AppID, link.CredentialID = stored.AppID, stored.CredentialID
+	if !s.issuerActive(stored.CredentialID) {
+		return link, ErrShareRevoked
+	}
+
+	// Links outlive a trashed or destroyed file until they expire; opening
+	// them then must not use up a download
+	var files int64
+	if err := s.DB.Model(&model.FileMetadata{}).Where("id = ? AND app_id = ?", link.FileID, link.AppID).Count(&files).Error; err != nil {
+		return link, err
+	}
+	if files == 0 {
+		return link, ErrShareFileGone
+	}
+
+	// Counting and the limit check are one statement, so concurrent requests
+	// cannot exceed max_downloads
+	result := s.DB.Model(&model.ShareLink{}).
+		Where("id = ? AND (max_downloads = 0 OR downloads < max_downloads)", link.ID).
+		UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+	if result.Error != nil {
+		return link, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return stored, ErrShareExhausted
+	}
+
+	err = s.DB.First(&link, "id = ?", link.ID).Error
+	return link, err
+}
+
+// issuerActive reports whether the API credential or client certificate that
+// created a link still exists and is not revoked.
+func (s *ShareService) issuerActive(id uuid.UUID) bool {
+	var count int64
+	s.DB.Model(&model.ApiCredential{}).Where("id = ? AND revoked_at IS NULL", id).Count(&count)
+	if count == 0 {
+		s.DB.Model(&model.ClientCertificate{}).Where("id = ? AND revoked_at IS NULL", id).Count(&count)
+	}
+	return count > 0
+}
+
+// PurgeExpired deletes the rows of links that can no longer be used.
+func (s *ShareService) PurgeExpired(now time.Time) int64 {
+	return s.DB.Where("expires_at <= ?", now).Delete(&model.ShareLink{}).RowsAffected
+}
+
+func signShare(claims shareClaims) (string, error) {
+	key, err := crypto.DeriveKey(shareKeyPurpose)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func verifyShare(token string) (shareClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return shareClaims{}, ErrShareInvalid
+	}
+
+	key, err := crypto.DeriveKey(shareKeyPurpose)
+	if err != nil {
+		return shareClaims{}, err
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return shareClaims{}, ErrShareInvalid
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return shareClaims{}, ErrShareInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return shareClaims{}, ErrShareInvalid
+	}
+	var claims shareClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return shareClaims{}, ErrShareInvalid
+	}
+	return claims, nil
+}
+
+func ipAllowed(allowed, ip string) bool {
+	if allowed == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(allowed); err == nil {
+		return network.Contains(addr)
+	}
+	return addr.Equal(net.ParseIP(allowed))
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/config"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated in-memory database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection keeps a single in-memory database for the whole test
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := config.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newMemoryBucket stores an app and a bucket on the MEMORY provider, in a
+// namespace of its own.
+func newMemoryBucket(t *testing.T, db *gorm.DB, name string) model.Bucket {
+	t.Helper()
+
+	app := model.App{ID: uuid.New(), AppName: name + "-" + uuid.NewString(), IsActive: true}
+	if err := db.Create(&app).Error; err != nil {
+		t.Fatal(err)
+	}
+	bucket := model.Bucket{
+		ID:           uuid.New(),
+		AppID:        app.ID,
+		Name:         name,
+		ProviderType: "MEMORY",
+		Config:       `{"namespace":"` + uuid.NewString() + `"}`,
+	}
+	if err := db.Create(&bucket).Error; err != nil {
+		t.Fatal(err)
+	}
+	return bucket
+}
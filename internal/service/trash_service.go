@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"gorm.io/gorm"
+)
+
+// DefaultTrashRetentionDays applies to buckets without their own retention.
+const DefaultTrashRetentionDays = 30
+
+// TrashService permanently removes soft-deleted files once they have spent
+// their bucket's retention period in the trash.
+type TrashService struct {
+	DB    *gorm.DB
+	Blobs *BlobService
+	Audit *AuditService
+}
+
+func NewTrashService(db *gorm.DB, audit *AuditService) *TrashService {
+	return &TrashService{
+		DB:    db,
+		Blobs: NewBlobService(db),
+		Audit: audit,
+	}
+}
+
+// Run purges expired trash every interval until ctx is cancelled.
+func (s *TrashService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.PurgeExpired()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired physically deletes every trashed file past its retention and
+// returns how many were removed.
+func (s *TrashService) PurgeExpired() int {
+	var buckets []model.Bucket
+	s.DB.Find(&buckets)
+
+	purged := 0
+	for _, bucket := range buckets {
+		days := bucket.TrashRetentionDays
+		if days <= 0 {
+			days = DefaultTrashRetentionDays
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+
+		var files []model.FileMetadata
+		s.DB.Unscoped().
+			Where("bucket_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", bucket.ID, cutoff).
+			Find(&files)
+
+		for _, file := range files {
+			// Files trashed with a governance bypass wait for their retention
+			if err := CheckLock(file, false, time.Now()); err != nil {
+				continue
+			}
+
+			file.Bucket = bucket
+			if err := s.Blobs.Destroy(file); err != nil {
+				s.Audit.LogEvent("FILE_PURGE_ERROR",
+					fmt.Sprintf("Failed to purge file %s from bucket %s: %v", file.ID, bucket.Name, err), "ERROR")
+				continue
+			}
+
+			purged++
+			s.Audit.LogEvent("FILE_PURGED",
+				fmt.Sprintf("File %s (%s) purged from trash of bucket %s", file.ID, file.OriginalName, bucket.Name), "INFO")
+		}
+	}
+
+	return purged
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuotaError explains why a write was refused. TooLarge is set when a single
+// file is over the size limit; otherwise the bucket or app is full.
+type QuotaError struct {
+	Scope    string
+	Name     string
+	Reason   string
+	TooLarge bool
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Scope, e.Name, e.Reason)
+}
+
+// UsageService keeps the used_bytes and file_count counters of buckets and
+// apps. Counters are updated incrementally on every write and delete, so quota
+// checks never sum the files table. Trashed files keep counting until purged,
+// since they still take up space.
+type UsageService struct {
+	DB *gorm.DB
+}
+
+func NewUsageService(db *gorm.DB) *UsageService {
+	return &UsageService{DB: db}
+}
+
+// Reserve adds size bytes and files files to the bucket and its app if both
+// stay within their quotas, atomically. Call Add with negative values to undo
+// the reservation when the write fails.
+func (s *UsageService) Reserve(bucket model.Bucket, size, files int64) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserve(tx, "bucket", "buckets", "name", bucket.ID, size, files); err != nil {
+			return err
+		}
+		return reserve(tx, "app", "apps", "app_name", bucket.AppID, size, files)
+	})
+}
+
+// quotaRow is the quota and usage of a bucket or an app.
+type quotaRow struct {
+	Name        string
+	MaxBytes    int64
+	MaxFiles    int64
+	MaxFileSize int64
+	UsedBytes   int64
+	FileCount   int64
+}
+
+// reserve increments the counters of one row only if its limits allow it.
+// A limit of zero means unlimited.
+func reserve(tx *gorm.DB, scope, table, nameColumn string, id uuid.UUID, size, files int64) error {
+	result := tx.Table(table).
+		Where("id = ?", id).
+		Where("max_file_size = 0 OR max_file_size >= ?", size).
+		Where("max_bytes = 0 OR used_bytes + ? <= max_bytes", size).
+		Where("max_files = 0 OR file_count + ? <= max_files", files).
+		UpdateColumns(map[string]interface{}{
+			"used_bytes": gorm.Expr("used_bytes + ?", size),
+			"file_count": gorm.Expr("file_count + ?", files),
+		})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+
+	var row quotaRow
+	tx.Table(table).
+		Select(nameColumn+" AS name, max_bytes, max_files, max_file_size, used_bytes, file_count").
+		Where("id = ?", id).
+		Scan(&row)
+
+	switch {
+	case row.MaxFileSize > 0 && size > row.MaxFileSize:
+		return &QuotaError{Scope: scope, Name: row.Name, TooLarge: true,
+			Reason: fmt.Sprintf("file of %d bytes exceeds the maximum file size of %d bytes", size, row.MaxFileSize)}
+	case row.MaxFiles > 0 && row.FileCount+files > row.MaxFiles:
+		return &QuotaError{Scope: scope, Name: row.Name,
+			Reason: fmt.Sprintf("file quota of %d files reached", row.MaxFiles)}
+	default:
+		return &QuotaError{Scope: scope, Name: row.Name,
+			Reason: fmt.Sprintf("storage quota exceeded: %d of %d bytes used, %d more requested", row.UsedBytes, row.MaxBytes, size)}
+	}
+}
+
+// Add changes the counters of a bucket and its app without checking quotas.
+// Negative values release usage.
+func (s *UsageService) Add(bucketID, appID uuid.UUID, bytes, files int64) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		changes := map[string]interface{}{
+			"used_bytes": gorm.Expr("used_bytes + ?", bytes),
+			"file_count": gorm.Expr("file_count + ?", files),
+		}
+		if err := tx.Table("buckets").Where("id = ?", bucketID).UpdateColumns(changes).Error; err != nil {
+			return err
+		}
+		return tx.Table("apps").Where("id = ?", appID).UpdateColumns(changes).Error
+	})
+}
+
+// UsageChange is one change to the aggregated usage of a bucket, recorded in
+// the usage_stats table for analytics.
+type UsageChange struct {
+	BucketID    uuid.UUID
+	AppID       uuid.UUID
+	ContentType string
+	Bytes       int64
+	StoredBytes int64
+	Files       int64
+}
+
+// FileUsage is the usage of a file row; pass sign -1 when it goes away.
+func FileUsage(file model.FileMetadata, sign int64) UsageChange {
+	return UsageChange{
+		BucketID:    file.BucketID,
+		AppID:       file.AppID,
+		ContentType: file.ContentType,
+		Bytes:       sign * file.FileSize,
+		StoredBytes: sign * storedOrLogical(file.StoredSize, file.FileSize),
+		Files:       sign,
+	}
+}
+
+// VersionUsage is the usage of an archived version of a file.
+func VersionUsage(file model.FileMetadata, version model.FileVersion, sign int64) UsageChange {
+	return UsageChange{
+		BucketID:    file.BucketID,
+		AppID:       file.AppID,
+		ContentType: version.ContentType,
+		Bytes:       sign * version.FileSize,
+		StoredBytes: sign * storedOrLogical(version.StoredSize, version.FileSize),
+	}
+}
+
+// storedOrLogical counts files written before compression existed, which have
+// no stored size, at their logical size.
+func storedOrLogical(stored, logical int64) int64 {
+	if stored == 0 {
+		return logical
+	}
+	return stored
+}
+
+// Record adds a change to today's usage stats of the bucket.
+func (s *UsageService) Record(change UsageChange) error {
+	return s.upsertStat(s.DB, model.UsageStat{
+		Day:         today(),
+		BucketID:    change.BucketID,
+		ContentType: change.ContentType,
+		AppID:       change.AppID,
+		Bytes:       change.Bytes,
+		StoredBytes: change.StoredBytes,
+		Files:       change.Files,
+	})
+}
+
+func (s *UsageService) upsertStat(tx *gorm.DB, stat model.UsageStat) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "bucket_id"}, {Name: "content_type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes":        gorm.Expr("usage_stats.bytes + ?", stat.Bytes),
+			"stored_bytes": gorm.Expr("usage_stats.stored_bytes + ?", stat.StoredBytes),
+			"files":        gorm.Expr("usage_stats.files + ?", stat.Files),
+		}),
+	}).Create(&stat).Error
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// Recalculate rebuilds every counter from the files and versions tables. It
+// runs at startup to repair drift from crashes or manual changes. Usage stats
+// are backfilled by creation day the first time; afterwards any drift is
+// booked as a correction on today's stats, so the history is kept.
+func (s *UsageService) Recalculate() error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE buckets SET
+			used_bytes = COALESCE((SELECT SUM(f.file_size) FROM file_metadata f WHERE f.bucket_id = buckets.id), 0)
+				+ COALESCE((SELECT SUM(v.file_size) FROM file_versions v JOIN file_metadata f ON f.id = v.file_id WHERE f.bucket_id = buckets.id), 0),
+			file_count = (SELECT COUNT(*) FROM file_metadata f WHERE f.bucket_id = buckets.id)`).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`UPDATE apps SET
+			used_bytes = COALESCE((SELECT SUM(b.used_bytes) FROM buckets b WHERE b.app_id = apps.id), 0),
+			file_count = COALESCE((SELECT SUM(b.file_count) FROM buckets b WHERE b.app_id = apps.id), 0)`).Error
+		if err != nil {
+			return err
+		}
+
+		return s.reconcileStats(tx)
+	})
+}
+
+func (s *UsageService) reconcileStats(tx *gorm.DB) error {
+	var actual []model.UsageStat
+	err := tx.Raw(`SELECT day, bucket_id, app_id, content_type,
+			SUM(bytes) AS bytes, SUM(stored_bytes) AS stored_bytes, SUM(files) AS files
+		FROM (
+			SELECT DATE(f.created_at) AS day, f.bucket_id, f.app_id, COALESCE(f.content_type, '') AS content_type,
+				f.file_size AS bytes, COALESCE(NULLIF(f.stored_size, 0), f.file_size) AS stored_bytes, 1 AS files
+			FROM file_metadata f
+			UNION ALL
+			SELECT DATE(v.created_at), f.bucket_id, f.app_id, COALESCE(v.content_type, ''),
+				v.file_size, COALESCE(NULLIF(v.stored_size, 0), v.file_size), 0
+			FROM file_versions v JOIN file_metadata f ON f.id = v.file_id
+		) u
+		GROUP BY day, bucket_id, app_id, content_type`).Scan(&actual).Error
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	tx.Model(&model.UsageStat{}).Count(&count)
+	if count == 0 {
+		for _, stat := range actual {
+			if err := s.upsertStat(tx, stat); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type key struct {
+		BucketID    uuid.UUID
+		ContentType string
+	}
+
+	var recorded []model.UsageStat
+	err = tx.Model(&model.UsageStat{}).
+		Select("bucket_id, app_id, content_type, SUM(bytes) AS bytes, SUM(stored_bytes) AS stored_bytes, SUM(files) AS files").
+		Group("bucket_id, app_id, content_type").
+		Scan(&recorded).Error
+	if err != nil {
+		return err
+	}
+
+	drift := make(map[key]model.UsageStat)
+	for _, stat := range actual {
+		k := key{stat.BucketID, stat.ContentType}
+		d := drift[k]
+		d.BucketID, d.AppID, d.ContentType = stat.BucketID, stat.AppID, stat.ContentType
+		d.Bytes += stat.Bytes
+		d.StoredBytes += stat.StoredBytes
+		d.Files += stat.Files
+		drift[k] = d
+	}
+	for _, stat := range recorded {
+		k := key{stat.BucketID, stat.ContentType}
+		d := drift[k]
+		d.BucketID, d.AppID, d.ContentType = stat.BucketID, stat.AppID, stat.ContentType
+		d.Bytes -= stat.Bytes
+		d.StoredBytes -= stat.StoredBytes
+		d.Files -= stat.Files
+		drift[k] = d
+	}
+
+	for _, d := range drift {
+		if d.Bytes == 0 && d.StoredBytes == 0 && d.Files == 0 {
+			continue
+		}
+		d.Day = today()
+		if err := s.upsertStat(tx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
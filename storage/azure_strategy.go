@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+)
+
+// AzureBlobConfig authenticates either with a full connection string (this is
+// also what the Azurite emulator uses) or with an account URL plus a SAS token.
+type AzureBlobConfig struct {
+	ConnectionString string `json:"connection_string"`
+	AccountURL       string `json:"account_url"`
+	SASToken         string `json:"sas_token"`
+	Container        string `json:"container"`
+	Prefix           string `json:"path"`
+	BlockSizeMB      int64  `json:"block_size_mb"`
+}
+
+type AzureBlobStrategy struct{}
+
+func newAzureClient(configJSON string) (*azblob.Client, AzureBlobConfig, error) {
+	var cfg AzureBlobConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, cfg, fmt.Errorf("azure config error: %v", err)
+	}
+
+	if cfg.Container == "" {
+		return nil, cfg, fmt.Errorf("azure config error: container is required")
+	}
+
+	var client *azblob.Client
+	var err error
+	switch {
+	case cfg.ConnectionString != "":
+		client, err = azblob.NewClientFromConnectionString(cfg.ConnectionString, nil)
+	case cfg.AccountURL != "" && cfg.SASToken != "":
+		serviceURL := strings.TrimSuffix(cfg.AccountURL, "/") + "/?" + strings.TrimPrefix(cfg.SASToken, "?")
+		client, err = azblob.NewClientWithNoCredential(serviceURL, nil)
+	default:
+		return nil, cfg, fmt.Errorf("azure config error: connection_string or account_url with sas_token is required")
+	}
+	if err != nil {
+		return nil, cfg, fmt.Errorf("azure client error: %v", err)
+	}
+
+	return client, cfg, nil
+}
+
+func (cfg AzureBlobConfig) blobName(filePath string) string {
+	name := strings.TrimPrefix(filePath, "/")
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" && !strings.HasPrefix(name, prefix+"/") {
+		name = path.Join(prefix, name)
+	}
+	return name
+}
+
+func (s *AzureBlobStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	name := cfg.blobName(filename)
+
+	// AES-GCM needs the whole payload, so encrypted uploads are buffered.
+	// Plain uploads are streamed as staged blocks.
+	if shouldEncrypt {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("read stream error: %v", err)
+		}
+		data, err = crypto.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("encryption error: %v", err)
+		}
+		src = bytes.NewReader(data)
+	}
+
+	opts := &azblob.UploadStreamOptions{}
+	if cfg.BlockSizeMB > 0 {
+		opts.BlockSize = cfg.BlockSizeMB * 1024 * 1024
+	}
+
+	if _, err := client.UploadStream(context.TODO(), cfg.Container, name, src, opts); err != nil {
+		return "", fmt.Errorf("azure upload error: %w", err)
+	}
+
+	return name, nil
+}
+
+func (s *AzureBlobStrategy) Download(filePath string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(filePath, configJSON, 0, 0)
+}
+
+func (s *AzureBlobStrategy) DownloadRange(filePath string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.DownloadStream(context.TODO(), cfg.Container, cfg.blobName(filePath), &azblob.DownloadStreamOptions{
+		Range: azblob.HTTPRange{Offset: offset, Count: length},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("azure download error: %w", err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *AzureBlobStrategy) Delete(filePath string, configJSON string) error {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteBlob(context.TODO(), cfg.Container, cfg.blobName(filePath), nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("azure delete error: %w", err)
+	}
+
+	return nil
+}
+
+// PresignPut returns a write-only SAS URL for the blob Upload would create.
+// SAS URLs can only be signed when the bucket uses a connection string with
+// an account key.
+func (s *AzureBlobStrategy) PresignPut(filename string, configJSON string, contentType string, size int64, expires time.Duration) (PresignedRequest, error) {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	name := cfg.blobName(filename)
+	blobURL, err := client.ServiceClient().NewContainerClient(cfg.Container).NewBlobClient(name).
+		GetSASURL(sas.BlobPermissions{Create: true, Write: true}, time.Now().Add(expires), nil)
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("azure sas error: %w", err)
+	}
+
+	return PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       blobURL,
+		Headers:   map[string]string{"x-ms-blob-type": "BlockBlob", "Content-Type": contentType},
+		Path:      name,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+func (s *AzureBlobStrategy) PresignGet(filePath string, configJSON string, expires time.Duration) (PresignedRequest, error) {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	name := cfg.blobName(filePath)
+	blobURL, err := client.ServiceClient().NewContainerClient(cfg.Container).NewBlobClient(name).
+		GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(expires), nil)
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("azure sas error: %w", err)
+	}
+
+	return PresignedRequest{Method: http.MethodGet, URL: blobURL, Path: name, ExpiresAt: time.Now().Add(expires)}, nil
+}
+
+func (s *AzureBlobStrategy) Stat(filePath string, configJSON string) (ObjectInfo, error) {
+	client, cfg, err := newAzureClient(configJSON)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	name := cfg.blobName(filePath)
+	props, err := client.ServiceClient().NewContainerClient(cfg.Container).NewBlobClient(name).GetProperties(context.TODO(), nil)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("azure stat error: %w", err)
+	}
+
+	info := ObjectInfo{Path: name}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+	if props.LastModified != nil {
+		info.ModTime = *props.LastModified
+	}
+	return info, nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBlobService implements the subset of the Blob service REST API the
+// Azure strategy calls: staged and single-shot block blob uploads, ranged
+// downloads, properties and deletes.
+type fakeBlobService struct {
+	mu     sync.Mutex
+	blobs  map[string][]byte
+	blocks map[string][]byte
+}
+
+func newFakeBlobService(t *testing.T) (*fakeBlobService, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeBlobService{blobs: map[string][]byte{}, blocks: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Path-style URLs: /<account>/<container>/<blob>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key := parts[1] + "/" + parts[2]
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		data, _ := io.ReadAll(r.Body)
+		f.blocks[key+"#"+query.Get("blockid")] = data
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Blocks []string `xml:",any"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var blob []byte
+		for _, id := range list.Blocks {
+			block, ok := f.blocks[key+"#"+id]
+			if !ok {
+				blobError(w, http.StatusBadRequest, "InvalidBlockList")
+				return
+			}
+			blob = append(blob, block...)
+		}
+		f.blobs[key] = blob
+		setBlobHeaders(w, blob)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.blobs[key] = data
+		setBlobHeaders(w, data)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		blob, ok := f.blobs[key]
+		if !ok {
+			blobError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		setBlobHeaders(w, blob)
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		rng := r.Header.Get("x-ms-range")
+		if rng == "" {
+			rng = r.Header.Get("Range")
+		}
+		if rng == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(blob)
+			return
+		}
+		start, end, ok := parseByteRange(rng, int64(len(blob)))
+		if !ok {
+			blobError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(blob)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(blob[start : end+1])
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[key]; !ok {
+			blobError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(f.blobs, key)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func setBlobHeaders(w http.ResponseWriter, blob []byte) {
+	w.Header().Set("ETag", fmt.Sprintf(`"0x%X"`, len(blob)))
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+}
+
+func blobError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+// parseByteRange parses "bytes=start-" and "bytes=start-end", clamping the
+// end to the blob size.
+func parseByteRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	from, to, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if to != "" {
+		if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+func azureConfig(server *httptest.Server, extra string) string {
+	key := base64.StdEncoding.EncodeToString([]byte("fake-account-key"))
+	connection := "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + key +
+		";BlobEndpoint=" + server.URL + "/devstoreaccount1;"
+	return `{"connection_string":"` + connection + `","container":"records"` + extra + `}`
+}
+
+func TestAzureBlobRoundTrip(t *testing.T) {
+	_, server := newFakeBlobService(t)
+	roundTrip(t, &AzureBlobStrategy{}, azureConfig(server, `,"path":"tenant-a"`))
+}
+
+func TestAzureBlobStagesBlocks(t *testing.T) {
+	fake, server := newFakeBlobService(t)
+	config := azureConfig(server, `,"block_size_mb":1`)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 150*1024) // 2.4 MB, three blocks
+	stored, err := (&AzureBlobStrategy{}).Upload(bytes.NewReader(data), "scan.dcm", config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	blocks := len(fake.blocks)
+	blob := fake.blobs["records/"+stored]
+	fake.mu.Unlock()
+	if blocks != 3 {
+		t.Fatalf("staged %d blocks, want 3", blocks)
+	}
+	if !bytes.Equal(blob, data) {
+		t.Fatalf("committed blob has %d bytes, want %d", len(blob), len(data))
+	}
+}
+
+func TestAzureBlobMissingBlob(t *testing.T) {
+	_, server := newFakeBlobService(t)
+	config := azureConfig(server, "")
+	s := &AzureBlobStrategy{}
+
+	if _, err := s.Download("missing.txt", config); err == nil {
+		t.Fatal("download of a missing blob succeeded")
+	}
+	if _, err := s.Stat("missing.txt", config); err == nil {
+		t.Fatal("stat of a missing blob succeeded")
+	}
+	if err := s.Delete("missing.txt", config); err != nil {
+		t.Fatalf("delete of a missing blob: %v", err)
+	}
+}
@@ -81,3 +81,21 @@ func (s *DropboxStrategy) Download(path string, configJSON string) (io.ReadClose
 
 	return content, nil
 }
+
+func (s *DropboxStrategy) Delete(path string, configJSON string) error {
+	var cfg DropboxConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return fmt.Errorf("dropbox config error: %v", err)
+	}
+
+	dbxCfg := dropbox.Config{
+		Token: cfg.AccessToken,
+	}
+	client := files.New(dbxCfg)
+
+	if _, err := client.DeleteV2(files.NewDeleteArg(path)); err != nil {
+		return fmt.Errorf("dropbox api delete error: %v", err)
+	}
+
+	return nil
+}
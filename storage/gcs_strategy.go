@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSConfig accepts the service-account key either as an embedded JSON object
+// or as a JSON string. When it is empty the workload's default credentials are
+// used, unless an endpoint is set (fake-gcs-server), which runs unauthenticated.
+type GCSConfig struct {
+	BucketName      string          `json:"bucket_name"`
+	CredentialsJSON json.RawMessage `json:"credentials_json"`
+	Endpoint        string          `json:"endpoint"`
+	RootFolder      string          `json:"path"`
+	ChunkSizeMB     int             `json:"chunk_size_mb"`
+}
+
+type GCSStrategy struct{}
+
+func newGCSClient(ctx context.Context, configJSON string) (*gcs.Client, GCSConfig, error) {
+	var cfg GCSConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, cfg, fmt.Errorf("gcs config error: %v", err)
+	}
+
+	if cfg.BucketName == "" {
+		return nil, cfg, fmt.Errorf("gcs config error: bucket_name is required")
+	}
+
+	var opts []option.ClientOption
+	if creds := cfg.credentials(); len(creds) > 0 {
+		opts = append(opts, option.WithCredentialsJSON(creds))
+	} else if cfg.Endpoint != "" {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+
+	client, err := gcs.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, cfg, fmt.Errorf("gcs client error: %v", err)
+	}
+
+	return client, cfg, nil
+}
+
+func (cfg GCSConfig) credentials() []byte {
+	raw := bytes.TrimSpace(cfg.CredentialsJSON)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var asString string
+	if err := json.Unmarshal(raw, &asString); err == nil {
+		return []byte(asString)
+	}
+	return raw
+}
+
+func (cfg GCSConfig) objectName(filePath string) string {
+	name := strings.TrimPrefix(filePath, "/")
+	root := strings.Trim(cfg.RootFolder, "/")
+	if root != "" && !strings.HasPrefix(name, root+"/") {
+		name = path.Join(root, name)
+	}
+	return name
+}
+
+func (s *GCSStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	ctx := context.TODO()
+	client, cfg, err := newGCSClient(ctx, configJSON)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if shouldEncrypt {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("read stream error: %v", err)
+		}
+		data, err = crypto.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("encryption error: %v", err)
+		}
+		src = bytes.NewReader(data)
+	}
+
+	name := cfg.objectName(filename)
+
+	// A non-zero chunk size makes the writer use a resumable upload session,
+	// retrying each chunk on transient failures. Closing the writer commits
+	// whatever it has buffered, so a failed read cancels the upload instead.
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := client.Bucket(cfg.BucketName).Object(name).NewWriter(uploadCtx)
+	if cfg.ChunkSizeMB > 0 {
+		w.ChunkSize = cfg.ChunkSizeMB * 1024 * 1024
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		cancel()
+		return "", fmt.Errorf("gcs upload error: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("gcs upload error: %w", err)
+	}
+
+	return name, nil
+}
+
+func (s *GCSStrategy) Download(filePath string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(filePath, configJSON, 0, 0)
+}
+
+func (s *GCSStrategy) DownloadRange(filePath string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	ctx := context.TODO()
+	client, cfg, err := newGCSClient(ctx, configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if length <= 0 {
+		length = -1
+	}
+
+	reader, err := client.Bucket(cfg.BucketName).Object(cfg.objectName(filePath)).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("gcs download error: %w", err)
+	}
+
+	return &gcsReader{Reader: reader, client: client}, nil
+}
+
+func (s *GCSStrategy) Delete(filePath string, configJSON string) error {
+	ctx := context.TODO()
+	client, cfg, err := newGCSClient(ctx, configJSON)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = client.Bucket(cfg.BucketName).Object(cfg.objectName(filePath)).Delete(ctx)
+	if err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+		return fmt.Errorf("gcs delete error: %w", err)
+	}
+
+	return nil
+}
+
+func (s *GCSStrategy) List(prefix string, configJSON string) ([]ObjectInfo, error) {
+	ctx := context.TODO()
+	client, cfg, err := newGCSClient(ctx, configJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	query := &gcs.Query{Prefix: cfg.objectName(prefix)}
+	if prefix == "" && query.Prefix != "" {
+		query.Prefix += "/"
+	}
+
+	var objects []ObjectInfo
+	it := client.Bucket(cfg.BucketName).Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gcs list error: %w", err)
+		}
+		objects = append(objects, ObjectInfo{
+			Path:        attrs.Name,
+			Size:        attrs.Size,
+			ContentType: attrs.ContentType,
+			ModTime:     attrs.Updated,
+		})
+	}
+
+	return objects, nil
+}
+
+// gcsReader closes the client together with the object reader it produced.
+type gcsReader struct {
+	*gcs.Reader
+	client *gcs.Client
+}
+
+func (r *gcsReader) Close() error {
+	err := r.Reader.Close()
+	r.client.Close()
+	return err
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGCS implements the subset of the Cloud Storage JSON and XML APIs the
+// GCS strategy calls: multipart uploads, XML media reads, deletes and
+// object listings.
+type fakeGCS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeGCS(t *testing.T) (*fakeGCS, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeGCS{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+		f.upload(w, r, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/upload/storage/v1/b/"), "/o"))
+	case strings.HasPrefix(r.URL.Path, "/storage/v1/b/"):
+		bucket, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"), "/")
+		switch {
+		case rest == "o" && r.Method == http.MethodGet:
+			f.list(w, bucket, r.URL.Query().Get("prefix"))
+		case strings.HasPrefix(rest, "o/") && r.Method == http.MethodDelete:
+			key := bucket + "/" + strings.TrimPrefix(rest, "o/")
+			if _, ok := f.objects[key]; !ok {
+				gcsError(w, http.StatusNotFound)
+				return
+			}
+			delete(f.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			gcsError(w, http.StatusNotImplemented)
+		}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.read(w, r, strings.TrimPrefix(r.URL.Path, "/"))
+	default:
+		gcsError(w, http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.URL.Query().Get("uploadType") != "multipart" {
+		gcsError(w, http.StatusNotImplemented)
+		return
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		gcsError(w, http.StatusBadRequest)
+		return
+	}
+
+	parts := multipart.NewReader(r.Body, params["boundary"])
+	var meta struct {
+		Name        string `json:"name"`
+		ContentType string `json:"contentType"`
+	}
+	metaPart, err := parts.NextPart()
+	if err != nil || json.NewDecoder(metaPart).Decode(&meta) != nil {
+		gcsError(w, http.StatusBadRequest)
+		return
+	}
+	mediaPart, err := parts.NextPart()
+	if err != nil {
+		gcsError(w, http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(mediaPart)
+	if err != nil {
+		gcsError(w, http.StatusBadRequest)
+		return
+	}
+
+	f.objects[bucket+"/"+meta.Name] = data
+	json.NewEncoder(w).Encode(objectResource(bucket, meta.Name, data))
+}
+
+func (f *fakeGCS) read(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := f.objects[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	w.Header().Set("X-Goog-Hash", "crc32c="+base64.StdEncoding.EncodeToString(checksum))
+	w.Header().Set("X-Goog-Generation", "1")
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	rng := r.Header.Get("Range")
+	if rng == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	start, end, ok := parseByteRange(rng, int64(len(data)))
+	if !ok {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[start : end+1])
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, bucket, prefix string) {
+	var names []string
+	for key := range f.objects {
+		if name, ok := strings.CutPrefix(key, bucket+"/"); ok && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	items := []map[string]string{}
+	for _, name := range names {
+		items = append(items, objectResource(bucket, name, f.objects[bucket+"/"+name]))
+	}
+	json.NewEncoder(w).Encode(map[string]any{"kind": "storage#objects", "items": items})
+}
+
+func objectResource(bucket, name string, data []byte) map[string]string {
+	return map[string]string{
+		"kind":        "storage#object",
+		"bucket":      bucket,
+		"name":        name,
+		"size":        strconv.Itoa(len(data)),
+		"contentType": "application/octet-stream",
+		"generation":  "1",
+		"updated":     time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func gcsError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, status, http.StatusText(status))
+}
+
+func gcsConfig(server *httptest.Server, extra string) string {
+	return `{"bucket_name":"records","endpoint":"` + server.URL + `/storage/v1/"` + extra + `}`
+}
+
+func TestGCSRoundTrip(t *testing.T) {
+	_, server := newFakeGCS(t)
+	roundTrip(t, &GCSStrategy{}, gcsConfig(server, `,"path":"tenant-a"`))
+}
+
+func TestGCSListStaysUnderRoot(t *testing.T) {
+	_, server := newFakeGCS(t)
+	s := &GCSStrategy{}
+
+	for _, root := range []string{"tenant-a", "tenant-ab"} {
+		config := gcsConfig(server, `,"path":"`+root+`"`)
+		if _, err := s.Upload(bytes.NewReader([]byte(root)), "f.txt", config, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := s.List("", gcsConfig(server, `,"path":"tenant-a"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Path != "tenant-a/f.txt" {
+		t.Fatalf("list = %+v, want only tenant-a/f.txt", objects)
+	}
+}
+
+func TestGCSMissingObject(t *testing.T) {
+	_, server := newFakeGCS(t)
+	config := gcsConfig(server, "")
+	s := &GCSStrategy{}
+
+	if _, err := s.Download("missing.txt", config); err == nil {
+		t.Fatal("download of a missing object succeeded")
+	}
+	if err := s.Delete("missing.txt", config); err != nil {
+		t.Fatalf("delete of a missing object: %v", err)
+	}
+}
+
+// failingReader yields its data and then fails, like a client that drops
+// the connection partway through an upload.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestGCSFailedReadLeavesNoObject(t *testing.T) {
+	fake, server := newFakeGCS(t)
+	s := &GCSStrategy{}
+
+	src := &failingReader{data: bytes.Repeat([]byte("x"), 4096)}
+	if _, err := s.Upload(src, "partial.bin", gcsConfig(server, ""), false); err == nil {
+		t.Fatal("upload from a failing reader succeeded")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.objects) != 0 {
+		t.Fatalf("truncated upload was committed: %v", fake.objects)
+	}
+}
@@ -1,57 +1,250 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
 )
 
 type LocalStrategy struct{}
 
+// LocalConfig stores objects below BasePath. Objects are sharded into two
+// levels of directories taken from the start of the file name (ab/cd/abcd...)
+// unless DisableSharding is set.
 type LocalConfig struct {
-	BasePath string `json:"path"`
+	BasePath        string `json:"path"`
+	DisableSharding bool   `json:"disable_sharding"`
 }
 
-func (s *LocalStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+func parseLocalConfig(configJSON string) (LocalConfig, error) {
 	var cfg LocalConfig
 
 	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
-		return "", fmt.Errorf("config error: %v", err)
+		return cfg, fmt.Errorf("config error: %v", err)
 	}
 
 	if cfg.BasePath == "" {
-		return "", fmt.Errorf("basePath is empty. Check if JSON key is 'path'. Raw config: %s", configJSON)
+		return cfg, fmt.Errorf("basePath is empty. Check if JSON key is 'path'. Raw config: %s", configJSON)
+	}
+
+	base, err := filepath.Abs(cfg.BasePath)
+	if err != nil {
+		return cfg, fmt.Errorf("config error: invalid base path: %v", err)
 	}
+	cfg.BasePath = base
+
+	return cfg, nil
+}
 
-	if err := os.MkdirAll(cfg.BasePath, 0755); err != nil {
-		return "", fmt.Errorf("mkdir failed for path [%s]: %v", cfg.BasePath, err)
+// resolve maps a stored path to an absolute path confined to the base
+// directory. Stored paths are relative to the base; absolute paths written by
+// earlier versions are still accepted as long as they live inside it.
+func (cfg LocalConfig) resolve(stored string) (string, error) {
+	var full string
+	if filepath.IsAbs(stored) {
+		full = filepath.Clean(stored)
+	} else {
+		full = filepath.Join(cfg.BasePath, filepath.FromSlash(stored))
 	}
 
-	fullPath := filepath.Join(cfg.BasePath, filename)
+	if !within(cfg.BasePath, full) {
+		return "", fmt.Errorf("path %q escapes the bucket base directory", stored)
+	}
+
+	// Guard against symlinks inside the base pointing elsewhere.
+	realBase, err := filepath.EvalSymlinks(cfg.BasePath)
+	if err != nil {
+		return full, nil
+	}
+	if realFull, err := filepath.EvalSymlinks(full); err == nil && !within(realBase, realFull) {
+		return "", fmt.Errorf("path %q resolves outside the bucket base directory", stored)
+	}
 
-	data, err := io.ReadAll(src)
+	return full, nil
+}
+
+func within(base, target string) bool {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (cfg LocalConfig) shardedName(filename string) string {
+	name := filepath.Base(filename)
+	if cfg.DisableSharding || len(name) < 4 {
+		return name
+	}
+	return filepath.Join(name[0:2], name[2:4], name)
+}
+
+func (s *LocalStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	cfg, err := parseLocalConfig(configJSON)
 	if err != nil {
-		return "", fmt.Errorf("read stream error: %v", err)
+		return "", err
+	}
+
+	relPath := cfg.shardedName(filename)
+	fullPath, err := cfg.resolve(relPath)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("mkdir failed for path [%s]: %v", dir, err)
 	}
 
 	if shouldEncrypt {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("read stream error: %v", err)
+		}
+
 		data, err = crypto.Encrypt(data)
 		if err != nil {
 			return "", fmt.Errorf("encryption error: %v", err)
 		}
+		src = bytes.NewReader(data)
 	}
 
-	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+	if err := writeAtomic(fullPath, src); err != nil {
 		return "", fmt.Errorf("disk write error: %v", err)
 	}
 
-	return fullPath, nil
+	return filepath.ToSlash(relPath), nil
+}
+
+// writeAtomic writes to a temporary file in the destination directory, syncs
+// it, renames it over the target and syncs the directory, so a crash leaves
+// either the old file or the complete new one.
+func writeAtomic(fullPath string, src io.Reader) error {
+	dir := filepath.Dir(fullPath)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(fullPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, fullPath); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
 }
 
-func (s *LocalStrategy) Download(path string, config string) (io.ReadCloser, error) {
-	return os.Open(path)
+func (s *LocalStrategy) Download(path string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(path, configJSON, 0, 0)
+}
+
+func (s *LocalStrategy) DownloadRange(path string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	cfg, err := parseLocalConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	fullPath, err := cfg.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset == 0 && length <= 0 {
+		return f, nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length <= 0 {
+		return f, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStrategy) Delete(path string, configJSON string) error {
+	cfg, err := parseLocalConfig(configJSON)
+	if err != nil {
+		return err
+	}
+
+	fullPath, err := cfg.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("disk delete error: %v", err)
+	}
+	return nil
+}
+
+// RelativeLocalPath converts an absolute path stored by earlier versions into
+// the base-relative form. It reports false when the path is already relative
+// or lies outside the bucket's base directory.
+func RelativeLocalPath(stored string, configJSON string) (string, bool) {
+	if !filepath.IsAbs(stored) {
+		return "", false
+	}
+
+	cfg, err := parseLocalConfig(configJSON)
+	if err != nil {
+		return "", false
+	}
+
+	full := filepath.Clean(stored)
+	if !within(cfg.BasePath, full) {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(cfg.BasePath, full)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
 }
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+)
+
+var (
+	ErrInjectedFault       = errors.New("memory storage: injected fault")
+	ErrMemoryObjectTooBig  = errors.New("memory storage: object exceeds max_object_size")
+	ErrMemoryStoreFull     = errors.New("memory storage: store exceeds max_bytes or max_objects")
+	ErrMemoryObjectMissing = errors.New("memory storage: object not found")
+	ErrMemoryInvalidRange  = errors.New("memory storage: negative range offset")
+)
+
+// MemoryConfig keeps objects in process memory. Buckets sharing a namespace
+// share their objects, which lets tests point a primary and a replica bucket
+// at isolated or common stores. Zero limits mean unlimited.
+type MemoryConfig struct {
+	Namespace     string       `json:"namespace"`
+	RootPath      string       `json:"path"`
+	MaxBytes      int64        `json:"max_bytes"`
+	MaxObjectSize int64        `json:"max_object_size"`
+	MaxObjects    int          `json:"max_objects"`
+	Faults        MemoryFaults `json:"faults"`
+}
+
+// MemoryFaults describes deterministic failures. Calls are counted per
+// namespace across the operations listed in Ops (all operations when empty):
+// "upload", "download", "delete" and "list".
+type MemoryFaults struct {
+	FailOnCall   int      `json:"fail_on_call"`
+	FailEvery    int      `json:"fail_every"`
+	Ops          []string `json:"ops"`
+	LatencyMS    int      `json:"latency_ms"`
+	CorruptReads bool     `json:"corrupt_reads"`
+}
+
+func (f MemoryFaults) isZero() bool {
+	return f.FailOnCall == 0 && f.FailEvery == 0 && f.LatencyMS == 0 && !f.CorruptReads
+}
+
+func (f MemoryFaults) applies(op string) bool {
+	if len(f.Ops) == 0 {
+		return true
+	}
+	for _, o := range f.Ops {
+		if strings.EqualFold(o, op) {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryStore is the backing store of one namespace.
+type MemoryStore struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+	size    int64
+	calls   int
+	faults  *MemoryFaults
+}
+
+var (
+	memoryStoresMu sync.Mutex
+	memoryStores   = map[string]*MemoryStore{}
+)
+
+// MemoryNamespace returns the store behind a namespace, creating it if needed,
+// so tests can inspect contents or change faults at runtime.
+func MemoryNamespace(name string) *MemoryStore {
+	if name == "" {
+		name = "default"
+	}
+
+	memoryStoresMu.Lock()
+	defer memoryStoresMu.Unlock()
+
+	store, ok := memoryStores[name]
+	if !ok {
+		store = &MemoryStore{objects: map[string]memoryObject{}}
+		memoryStores[name] = store
+	}
+	return store
+}
+
+// SetFaults overrides the faults from the bucket config for this namespace and
+// restarts the call counter. Pass the zero value to fall back to the config.
+func (m *MemoryStore) SetFaults(f MemoryFaults) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = 0
+	if f.isZero() {
+		m.faults = nil
+		return
+	}
+	m.faults = &f
+}
+
+// Reset drops every object, fault and counter in the namespace.
+func (m *MemoryStore) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects = map[string]memoryObject{}
+	m.size = 0
+	m.calls = 0
+	m.faults = nil
+}
+
+// Calls reports how many operations the namespace has counted for faults.
+func (m *MemoryStore) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// Object returns a copy of the stored bytes.
+func (m *MemoryStore) Object(objectPath string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[objectPath]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), obj.data...), true
+}
+
+// Size reports the stored bytes across all objects.
+func (m *MemoryStore) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
+
+// enter counts the call and applies latency and failures. It returns the
+// faults in effect so reads can decide whether to corrupt.
+func (m *MemoryStore) enter(op string, cfg MemoryConfig) (MemoryFaults, error) {
+	m.mu.Lock()
+	faults := cfg.Faults
+	if m.faults != nil {
+		faults = *m.faults
+	}
+
+	fail := false
+	if faults.applies(op) {
+		m.calls++
+		if faults.FailOnCall > 0 && m.calls == faults.FailOnCall {
+			fail = true
+		}
+		if faults.FailEvery > 0 && m.calls%faults.FailEvery == 0 {
+			fail = true
+		}
+	}
+	m.mu.Unlock()
+
+	if faults.applies(op) && faults.LatencyMS > 0 {
+		time.Sleep(time.Duration(faults.LatencyMS) * time.Millisecond)
+	}
+	if fail {
+		return faults, fmt.Errorf("%w (%s)", ErrInjectedFault, op)
+	}
+	return faults, nil
+}
+
+type MemoryStrategy struct{}
+
+func parseMemoryConfig(configJSON string) (MemoryConfig, error) {
+	var cfg MemoryConfig
+	if strings.TrimSpace(configJSON) == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return cfg, fmt.Errorf("memory config error: %v", err)
+	}
+	return cfg, nil
+}
+
+func (cfg MemoryConfig) objectPath(filePath string) string {
+	name := strings.TrimPrefix(filePath, "/")
+	root := strings.Trim(cfg.RootPath, "/")
+	if root != "" && !strings.HasPrefix(name, root+"/") {
+		name = path.Join(root, name)
+	}
+	return name
+}
+
+func (s *MemoryStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	cfg, err := parseMemoryConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+	store := MemoryNamespace(cfg.Namespace)
+
+	if _, err := store.enter("upload", cfg); err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", fmt.Errorf("read stream error: %v", err)
+	}
+
+	if shouldEncrypt {
+		data, err = crypto.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("encryption error: %v", err)
+		}
+	}
+
+	if cfg.MaxObjectSize > 0 && int64(len(data)) > cfg.MaxObjectSize {
+		return "", ErrMemoryObjectTooBig
+	}
+
+	objectPath := cfg.objectPath(filename)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	previous, replacing := store.objects[objectPath]
+	newSize := store.size - int64(len(previous.data)) + int64(len(data))
+	if cfg.MaxBytes > 0 && newSize > cfg.MaxBytes {
+		return "", ErrMemoryStoreFull
+	}
+	if cfg.MaxObjects > 0 && !replacing && len(store.objects) >= cfg.MaxObjects {
+		return "", ErrMemoryStoreFull
+	}
+
+	store.objects[objectPath] = memoryObject{data: data, modTime: time.Now()}
+	store.size = newSize
+
+	return objectPath, nil
+}
+
+func (s *MemoryStrategy) Download(filePath string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(filePath, configJSON, 0, 0)
+}
+
+func (s *MemoryStrategy) DownloadRange(filePath string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, ErrMemoryInvalidRange
+	}
+	cfg, err := parseMemoryConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	store := MemoryNamespace(cfg.Namespace)
+
+	faults, err := store.enter("download", cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := store.Object(cfg.objectPath(filePath))
+	if !ok {
+		return nil, ErrMemoryObjectMissing
+	}
+
+	if faults.CorruptReads && len(data) > 0 {
+		data[len(data)/2] ^= 0xFF
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStrategy) Delete(filePath string, configJSON string) error {
+	cfg, err := parseMemoryConfig(configJSON)
+	if err != nil {
+		return err
+	}
+	store := MemoryNamespace(cfg.Namespace)
+
+	if _, err := store.enter("delete", cfg); err != nil {
+		return err
+	}
+
+	objectPath := cfg.objectPath(filePath)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if obj, ok := store.objects[objectPath]; ok {
+		store.size -= int64(len(obj.data))
+		delete(store.objects, objectPath)
+	}
+	return nil
+}
+
+func (s *MemoryStrategy) List(prefix string, configJSON string) ([]ObjectInfo, error) {
+	cfg, err := parseMemoryConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	store := MemoryNamespace(cfg.Namespace)
+
+	if _, err := store.enter("list", cfg); err != nil {
+		return nil, err
+	}
+
+	full := cfg.objectPath(prefix)
+	if prefix == "" && full != "" {
+		full += "/"
+	}
+
+	store.mu.Lock()
+	var objects []ObjectInfo
+	for p, obj := range store.objects {
+		if strings.HasPrefix(p, full) {
+			objects = append(objects, ObjectInfo{Path: p, Size: int64(len(obj.data)), ModTime: obj.modTime})
+		}
+	}
+	store.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+	return objects, nil
+}
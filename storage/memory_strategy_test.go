@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func memoryConfig(extra string) (string, *MemoryStore) {
+	namespace := uuid.NewString()
+	return `{"namespace":"` + namespace + `","path":"root"` + extra + `}`, MemoryNamespace(namespace)
+}
+
+func TestMemoryRoundTrip(t *testing.T) {
+	config, _ := memoryConfig("")
+	roundTrip(t, &MemoryStrategy{}, config)
+}
+
+func TestMemoryRejectsNegativeRangeOffset(t *testing.T) {
+	config, _ := memoryConfig("")
+	s := &MemoryStrategy{}
+	stored, err := s.Upload(bytes.NewReader([]byte("0123456789")), "f.txt", config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.DownloadRange(stored, config, -1, 4); !errors.Is(err, ErrMemoryInvalidRange) {
+		t.Fatalf("negative offset: err = %v, want ErrMemoryInvalidRange", err)
+	}
+
+	// An offset past the end is an empty read, not an error
+	reader, err := s.DownloadRange(stored, config, 50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, reader); len(got) != 0 {
+		t.Fatalf("read past the end = %q", got)
+	}
+}
+
+func TestMemoryNamespacesAreIsolated(t *testing.T) {
+	first, firstStore := memoryConfig("")
+	second, _ := memoryConfig("")
+	s := &MemoryStrategy{}
+
+	stored, err := s.Upload(bytes.NewReader([]byte("data")), "f.txt", first, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := firstStore.Object(stored); !ok {
+		t.Fatal("object missing from its namespace")
+	}
+	if _, err := s.Download(stored, second); !errors.Is(err, ErrMemoryObjectMissing) {
+		t.Fatalf("download from another namespace: err = %v", err)
+	}
+}
+
+func TestMemoryLimits(t *testing.T) {
+	s := &MemoryStrategy{}
+
+	config, _ := memoryConfig(`,"max_object_size":4`)
+	if _, err := s.Upload(bytes.NewReader([]byte("12345")), "big", config, false); !errors.Is(err, ErrMemoryObjectTooBig) {
+		t.Fatalf("oversized object: err = %v", err)
+	}
+
+	config, store := memoryConfig(`,"max_bytes":8`)
+	if _, err := s.Upload(bytes.NewReader([]byte("12345")), "a", config, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(bytes.NewReader([]byte("12345")), "b", config, false); !errors.Is(err, ErrMemoryStoreFull) {
+		t.Fatalf("store over max_bytes: err = %v", err)
+	}
+	// Replacing an object only counts the difference
+	if _, err := s.Upload(bytes.NewReader([]byte("1234567")), "a", config, false); err != nil {
+		t.Fatalf("replacing within max_bytes: %v", err)
+	}
+	if store.Size() != 7 {
+		t.Fatalf("size = %d, want 7", store.Size())
+	}
+
+	config, _ = memoryConfig(`,"max_objects":1`)
+	if _, err := s.Upload(bytes.NewReader([]byte("1")), "a", config, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(bytes.NewReader([]byte("2")), "b", config, false); !errors.Is(err, ErrMemoryStoreFull) {
+		t.Fatalf("store over max_objects: err = %v", err)
+	}
+}
+
+func TestMemoryFaults(t *testing.T) {
+	s := &MemoryStrategy{}
+
+	t.Run("fail on call", func(t *testing.T) {
+		config, _ := memoryConfig(`,"faults":{"fail_on_call":2,"ops":["upload"]}`)
+		var errs []error
+		for i := 0; i < 3; i++ {
+			_, err := s.Upload(bytes.NewReader([]byte("x")), "f", config, false)
+			errs = append(errs, err)
+		}
+		if errs[0] != nil || !errors.Is(errs[1], ErrInjectedFault) || errs[2] != nil {
+			t.Fatalf("errors = %v, want only the second upload to fail", errs)
+		}
+	})
+
+	t.Run("fail every", func(t *testing.T) {
+		config, store := memoryConfig("")
+		stored, err := s.Upload(bytes.NewReader([]byte("x")), "f", config, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetFaults(MemoryFaults{FailEvery: 2, Ops: []string{"download"}})
+
+		failures := 0
+		for i := 0; i < 6; i++ {
+			if reader, err := s.Download(stored, config); err != nil {
+				failures++
+			} else {
+				reader.Close()
+			}
+		}
+		if failures != 3 || store.Calls() != 6 {
+			t.Fatalf("failures = %d over %d calls, want 3 over 6", failures, store.Calls())
+		}
+
+		// Uploads are not in Ops and never fail
+		if _, err := s.Upload(bytes.NewReader([]byte("y")), "g", config, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("corrupt reads", func(t *testing.T) {
+		config, store := memoryConfig("")
+		stored, err := s.Upload(bytes.NewReader([]byte("abcdef")), "f", config, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetFaults(MemoryFaults{CorruptReads: true})
+		if got := download(t, s, stored, config); bytes.Equal(got, []byte("abcdef")) {
+			t.Fatal("corrupt_reads returned the stored bytes")
+		}
+
+		store.SetFaults(MemoryFaults{})
+		if got := download(t, s, stored, config); !bytes.Equal(got, []byte("abcdef")) {
+			t.Fatalf("after clearing faults: %q", got)
+		}
+		if stored, _ := store.Object(stored); !bytes.Equal(stored, []byte("abcdef")) {
+			t.Fatal("corrupt reads changed the stored object")
+		}
+	})
+}
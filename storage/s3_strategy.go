@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -124,3 +126,107 @@ func (s *S3Strategy) Delete(filePath string, configJSON string) error {
 
 	return err
 }
+
+func newS3Client(configJSON string) (*s3.Client, S3Config, error) {
+	var cfg S3Config
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, cfg, err
+	}
+
+	staticResolver := credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")
+	sdkConfig, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(staticResolver),
+	)
+	if err != nil {
+		return nil, cfg, err
+	}
+
+	return s3.NewFromConfig(sdkConfig), cfg, nil
+}
+
+// PresignPut authorizes one PUT of exactly size bytes under the same key
+// Upload would use.
+func (s *S3Strategy) PresignPut(filename string, configJSON string, contentType string, size int64, expires time.Duration) (PresignedRequest, error) {
+	client, cfg, err := newS3Client(configJSON)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	fullKey := strings.TrimPrefix(path.Join(cfg.RootFolder, filename), "/")
+
+	req, err := s3.NewPresignClient(client).PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        aws.String(cfg.BucketName),
+		Key:           aws.String(fullKey),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("s3 presign error: %w", err)
+	}
+
+	return presignedRequest(req.Method, req.URL, req.SignedHeader, fullKey, expires), nil
+}
+
+func (s *S3Strategy) PresignGet(filePath string, configJSON string, expires time.Duration) (PresignedRequest, error) {
+	client, cfg, err := newS3Client(configJSON)
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	finalKey := strings.TrimPrefix(filePath, "/")
+
+	req, err := s3.NewPresignClient(client).PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(cfg.BucketName),
+		Key:    aws.String(finalKey),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return PresignedRequest{}, fmt.Errorf("s3 presign error: %w", err)
+	}
+
+	return presignedRequest(req.Method, req.URL, req.SignedHeader, finalKey, expires), nil
+}
+
+func (s *S3Strategy) Stat(filePath string, configJSON string) (ObjectInfo, error) {
+	client, cfg, err := newS3Client(configJSON)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	finalKey := strings.TrimPrefix(filePath, "/")
+
+	head, err := client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(cfg.BucketName),
+		Key:    aws.String(finalKey),
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("s3 stat error: %w", err)
+	}
+
+	return ObjectInfo{
+		Path:        finalKey,
+		Size:        aws.ToInt64(head.ContentLength),
+		ContentType: aws.ToString(head.ContentType),
+		ModTime:     aws.ToTime(head.LastModified),
+	}, nil
+}
+
+// presignedRequest keeps the headers the client has to repeat; Host is implied
+// by the URL.
+func presignedRequest(method, url string, signed http.Header, objectPath string, expires time.Duration) PresignedRequest {
+	headers := make(map[string]string, len(signed))
+	for name, values := range signed {
+		if strings.EqualFold(name, "Host") {
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	return PresignedRequest{
+		Method:    method,
+		URL:       url,
+		Headers:   headers,
+		Path:      objectPath,
+		ExpiresAt: time.Now().Add(expires),
+	}
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPConfig requires the server host key to be pinned, either through a
+// known_hosts file on this machine, inline known_hosts lines, or the SHA256
+// fingerprint printed by `ssh-keygen -lf`.
+type SFTPConfig struct {
+	Host               string `json:"host"`
+	Port               int    `json:"port"`
+	User               string `json:"user"`
+	Password           string `json:"password"`
+	PrivateKey         string `json:"private_key"`
+	Passphrase         string `json:"passphrase"`
+	KnownHostsFile     string `json:"known_hosts_file"`
+	KnownHosts         string `json:"known_hosts"`
+	HostKeyFingerprint string `json:"host_key_fingerprint"`
+	RootDir            string `json:"path"`
+	TimeoutSeconds     int    `json:"timeout_seconds"`
+}
+
+type SFTPStrategy struct{}
+
+// sftpSession bundles the SSH connection with the SFTP client running on it.
+type sftpSession struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (s *sftpSession) Close() error {
+	err := s.Client.Close()
+	s.conn.Close()
+	return err
+}
+
+func newSFTPSession(configJSON string) (*sftpSession, SFTPConfig, error) {
+	var cfg SFTPConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, cfg, fmt.Errorf("sftp config error: %v", err)
+	}
+
+	if cfg.Host == "" || cfg.User == "" {
+		return nil, cfg, fmt.Errorf("sftp config error: host and user are required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 22
+	}
+
+	hostKeyCallback, err := cfg.hostKeyCallback()
+	if err != nil {
+		return nil, cfg, err
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		var signer ssh.Signer
+		if cfg.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(cfg.PrivateKey), []byte(cfg.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		}
+		if err != nil {
+			return nil, cfg, fmt.Errorf("sftp config error: invalid private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, cfg, fmt.Errorf("sftp config error: password or private_key is required")
+	}
+
+	timeout := 30 * time.Second
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, cfg, fmt.Errorf("sftp connection error: %v", err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, cfg, fmt.Errorf("sftp session error: %v", err)
+	}
+
+	return &sftpSession{Client: client, conn: conn}, cfg, nil
+}
+
+func (cfg SFTPConfig) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	switch {
+	case cfg.KnownHostsFile != "":
+		cb, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("sftp config error: known_hosts_file: %v", err)
+		}
+		return cb, nil
+	case cfg.KnownHosts != "":
+		return inlineKnownHosts(cfg.KnownHosts)
+	case cfg.HostKeyFingerprint != "":
+		want := cfg.HostKeyFingerprint
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != want {
+				return fmt.Errorf("sftp host key mismatch for %s: got %s", hostname, got)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("sftp config error: host key pinning is required (known_hosts_file, known_hosts or host_key_fingerprint)")
+	}
+}
+
+// inlineKnownHosts accepts plain known_hosts lines. Hashed host names and
+// wildcard patterns are only supported through known_hosts_file.
+func inlineKnownHosts(content string) (ssh.HostKeyCallback, error) {
+	pinned := map[string][]ssh.PublicKey{}
+	rest := []byte(content)
+	for len(bytes.TrimSpace(rest)) > 0 {
+		_, hosts, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("sftp config error: known_hosts: %v", err)
+		}
+		for _, h := range hosts {
+			pinned[h] = append(pinned[h], key)
+		}
+		rest = next
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, candidate := range pinned[knownhosts.Normalize(hostname)] {
+			if bytes.Equal(candidate.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("sftp host key for %s is not pinned", hostname)
+	}, nil
+}
+
+func (cfg SFTPConfig) remotePath(filePath string) string {
+	root := strings.TrimSuffix(cfg.RootDir, "/")
+	if root != "" && (filePath == root || strings.HasPrefix(filePath, root+"/")) {
+		return filePath
+	}
+	return path.Join(root, filePath)
+}
+
+func (s *SFTPStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	client, cfg, err := newSFTPSession(configJSON)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if shouldEncrypt {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("read stream error: %v", err)
+		}
+		data, err = crypto.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("encryption error: %v", err)
+		}
+		src = bytes.NewReader(data)
+	}
+
+	fullPath := cfg.remotePath(filename)
+	if err := client.MkdirAll(path.Dir(fullPath)); err != nil {
+		return "", fmt.Errorf("sftp mkdir error: %v", err)
+	}
+
+	// Write to a temporary name and rename once complete, so readers never
+	// observe a partially transferred file.
+	tmpPath := fullPath + ".part-" + uuid.NewString()
+	f, err := client.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("sftp create error: %v", err)
+	}
+
+	if _, err := f.ReadFrom(src); err != nil {
+		f.Close()
+		client.Remove(tmpPath)
+		return "", fmt.Errorf("sftp write error: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		client.Remove(tmpPath)
+		return "", fmt.Errorf("sftp write error: %v", err)
+	}
+
+	if err := renameOver(client, tmpPath, fullPath); err != nil {
+		client.Remove(tmpPath)
+		return "", fmt.Errorf("sftp rename error: %v", err)
+	}
+
+	return fullPath, nil
+}
+
+// renameOver prefers the OpenSSH posix-rename extension, which replaces the
+// target atomically. Plain SFTP rename fails when the target exists.
+func renameOver(client *sftpSession, from, to string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(from, to)
+	}
+	if err := client.Remove(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return client.Rename(from, to)
+}
+
+func (s *SFTPStrategy) Download(filePath string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(filePath, configJSON, 0, 0)
+}
+
+func (s *SFTPStrategy) DownloadRange(filePath string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	client, cfg, err := newSFTPSession(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := client.Open(cfg.remotePath(filePath))
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("sftp open error: %v", err)
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			client.Close()
+			return nil, fmt.Errorf("sftp seek error: %v", err)
+		}
+	}
+
+	var r io.Reader = f
+	if length > 0 {
+		r = io.LimitReader(f, length)
+	}
+
+	return &sftpReader{Reader: r, file: f, session: client}, nil
+}
+
+func (s *SFTPStrategy) Delete(filePath string, configJSON string) error {
+	client, cfg, err := newSFTPSession(configJSON)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Remove(cfg.remotePath(filePath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("sftp delete error: %v", err)
+	}
+
+	return nil
+}
+
+// sftpReader keeps the SSH session open until the caller is done reading.
+type sftpReader struct {
+	io.Reader
+	file    *sftp.File
+	session *sftpSession
+}
+
+func (r *sftpReader) Close() error {
+	err := r.file.Close()
+	r.session.Close()
+	return err
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// fakeSFTP is an in-process SSH server running the pkg/sftp subsystem over
+// a temporary directory, accepting one user with a password.
+type fakeSFTP struct {
+	addr    string
+	root    string
+	hostKey ssh.PublicKey
+}
+
+func newFakeSFTP(t *testing.T) *fakeSFTP {
+	t.Helper()
+
+	signer := newSSHSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "records" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+
+	return &fakeSFTP{addr: listener.Addr().String(), root: t.TempDir(), hostKey: signer.PublicKey()}
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				// The payload is the length-prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						defer channel.Close()
+						if server, err := sftp.NewServer(channel); err == nil {
+							server.Serve()
+						}
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// config returns a strategy configuration for the fake, with pinning
+// (and any other fields) supplied through extra.
+func (f *fakeSFTP) config(t *testing.T, extra string) string {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(f.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return `{"host":"` + host + `","port":` + port + `,"user":"records","password":"secret","path":"` + filepath.ToSlash(f.root) + `"` + extra + `}`
+}
+
+func (f *fakeSFTP) knownHostsLine(key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(f.addr)}, key)
+}
+
+func TestSFTPRoundTrip(t *testing.T) {
+	server := newFakeSFTP(t)
+
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsFile, []byte(server.knownHostsLine(server.hostKey)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pinning := map[string]string{
+		"fingerprint": `,"host_key_fingerprint":"` + ssh.FingerprintSHA256(server.hostKey) + `"`,
+		// Comments and keys for other hosts are skipped
+		"inline known_hosts": `,"known_hosts":"# pinned by ops\n` +
+			knownhosts.Line([]string{"backup.example.org"}, newSSHSigner(t).PublicKey()) + `\n` +
+			server.knownHostsLine(server.hostKey) + `\n"`,
+		"known_hosts file": `,"known_hosts_file":"` + filepath.ToSlash(knownHostsFile) + `"`,
+	}
+	for name, extra := range pinning {
+		t.Run(name, func(t *testing.T) {
+			roundTrip(t, &SFTPStrategy{}, server.config(t, extra))
+		})
+	}
+}
+
+func TestSFTPRejectsUnpinnedHostKey(t *testing.T) {
+	server := newFakeSFTP(t)
+	other := newSSHSigner(t).PublicKey()
+
+	pinning := map[string]string{
+		"fingerprint":        `,"host_key_fingerprint":"` + ssh.FingerprintSHA256(other) + `"`,
+		"inline known_hosts": `,"known_hosts":"` + server.knownHostsLine(other) + `"`,
+		"no pinning":         ``,
+	}
+	for name, extra := range pinning {
+		t.Run(name, func(t *testing.T) {
+			_, err := (&SFTPStrategy{}).Upload(bytes.NewReader(roundTripContent), "report.txt", server.config(t, extra), false)
+			if err == nil || !strings.Contains(err.Error(), "host key") {
+				t.Fatalf("upload to a server with an unpinned host key: %v", err)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(server.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("rejected uploads wrote %d entries", len(entries))
+	}
+}
+
+func TestSFTPUploadReplacesWithoutLeavingTempFiles(t *testing.T) {
+	server := newFakeSFTP(t)
+	config := server.config(t, `,"host_key_fingerprint":"`+ssh.FingerprintSHA256(server.hostKey)+`"`)
+	s := &SFTPStrategy{}
+
+	var stored string
+	for _, content := range []string{"first draft", "final"} {
+		var err error
+		stored, err = s.Upload(strings.NewReader(content), "docs/report.txt", config, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := download(t, s, stored, config); string(got) != "final" {
+		t.Fatalf("download = %q, want the second upload", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(server.root, "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "report.txt" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("docs holds %v, want only report.txt", names)
+	}
+}
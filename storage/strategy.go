@@ -1,10 +1,59 @@
 package storage
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type StorageStrategy interface {
 	Upload(src io.Reader, filename string, config string, shouldEncrypt bool) (string, error)
 	Download(path string, config string) (io.ReadCloser, error)
+	Delete(path string, config string) error
+}
+
+// RangeDownloader is implemented by strategies that can read a byte range of a
+// stored object without fetching it entirely. Offsets refer to the stored bytes,
+// so ranges over encrypted objects return ciphertext. A length of 0 reads to the end.
+type RangeDownloader interface {
+	DownloadRange(path string, config string, offset, length int64) (io.ReadCloser, error)
+}
+
+// ObjectInfo describes an object as reported by the provider.
+type ObjectInfo struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Lister is implemented by strategies that can enumerate stored objects under a
+// prefix relative to the bucket root.
+type Lister interface {
+	List(prefix string, config string) ([]ObjectInfo, error)
+}
+
+// Stater is implemented by strategies that can describe a single stored
+// object without downloading it.
+type Stater interface {
+	Stat(path string, config string) (ObjectInfo, error)
+}
+
+// PresignedRequest is a short-lived request a client can send straight to the
+// provider. Headers must be sent exactly as given.
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Path      string            `json:"-"` // stored path of the object
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Presigner is implemented by strategies whose provider can authorize direct
+// transfers. The bytes never pass through this service, so presigned objects
+// are stored as sent: no encryption, compression or deduplication.
+type Presigner interface {
+	PresignPut(filename string, config string, contentType string, size int64, expires time.Duration) (PresignedRequest, error)
+	PresignGet(path string, config string, expires time.Duration) (PresignedRequest, error)
 }
 
 // Factory para obtener la estrategia según el tipo
@@ -16,6 +65,16 @@ func GetStrategy(pType string) (StorageStrategy, bool) {
 		return &S3Strategy{}, true
 	case "DROPBOX":
 		return &DropboxStrategy{}, true
+	case "AZURE_BLOB":
+		return &AzureBlobStrategy{}, true
+	case "GCS":
+		return &GCSStrategy{}, true
+	case "SFTP":
+		return &SFTPStrategy{}, true
+	case "WEBDAV":
+		return &WebDAVStrategy{}, true
+	case "MEMORY":
+		return &MemoryStrategy{}, true
 	default:
 		return nil, false
 	}
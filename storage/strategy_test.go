@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+)
+
+const testCipherKey = "0123456789abcdef0123456789abcdef"
+
+var roundTripContent = []byte("patient summary, version 1: round trip through the provider")
+
+// roundTrip stores, reads, describes, lists and deletes an object through
+// strategy, using every optional interface the strategy implements.
+func roundTrip(t *testing.T, strategy StorageStrategy, config string) {
+	t.Helper()
+	t.Setenv("STORAGE_CIPHER_KEY", testCipherKey)
+
+	stored, err := strategy.Upload(bytes.NewReader(roundTripContent), "docs/report.txt", config, false)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if got := download(t, strategy, stored, config); !bytes.Equal(got, roundTripContent) {
+		t.Fatalf("download = %q, want %q", got, roundTripContent)
+	}
+
+	if ranger, ok := strategy.(RangeDownloader); ok {
+		for _, r := range []struct{ offset, length int64 }{{8, 7}, {8, 0}, {0, 1}, {int64(len(roundTripContent)) - 3, 10}} {
+			reader, err := ranger.DownloadRange(stored, config, r.offset, r.length)
+			if err != nil {
+				t.Fatalf("range %d+%d: %v", r.offset, r.length, err)
+			}
+			got := readAll(t, reader)
+
+			want := roundTripContent[r.offset:]
+			if r.length > 0 && r.length < int64(len(want)) {
+				want = want[:r.length]
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("range %d+%d = %q, want %q", r.offset, r.length, got, want)
+			}
+		}
+	}
+
+	if stater, ok := strategy.(Stater); ok {
+		info, err := stater.Stat(stored, config)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if info.Size != int64(len(roundTripContent)) {
+			t.Fatalf("stat size = %d, want %d", info.Size, len(roundTripContent))
+		}
+	}
+
+	if lister, ok := strategy.(Lister); ok {
+		objects, err := lister.List("", config)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		found := false
+		for _, o := range objects {
+			if o.Path == stored {
+				found = o.Size == int64(len(roundTripContent))
+			}
+		}
+		if !found {
+			t.Fatalf("list = %+v, want %s with %d bytes", objects, stored, len(roundTripContent))
+		}
+	}
+
+	// Encrypted objects are stored as ciphertext and decrypt to the original
+	sealed, err := strategy.Upload(bytes.NewReader(roundTripContent), "docs/sealed.txt", config, true)
+	if err != nil {
+		t.Fatalf("encrypted upload: %v", err)
+	}
+	raw := download(t, strategy, sealed, config)
+	if bytes.Contains(raw, roundTripContent) {
+		t.Fatal("encrypted upload stored the plaintext")
+	}
+	if plain, err := crypto.Decrypt(raw); err != nil || !bytes.Equal(plain, roundTripContent) {
+		t.Fatalf("decrypting the stored object: %q, %v", plain, err)
+	}
+
+	for _, p := range []string{stored, sealed} {
+		if err := strategy.Delete(p, config); err != nil {
+			t.Fatalf("delete %s: %v", p, err)
+		}
+		if reader, err := strategy.Download(p, config); err == nil {
+			reader.Close()
+			t.Fatalf("download of deleted %s succeeded", p)
+		}
+	}
+	// Deleting what is already gone is not an error
+	if err := strategy.Delete(stored, config); err != nil {
+		t.Fatalf("second delete: %v", err)
+	}
+}
+
+func download(t *testing.T, strategy StorageStrategy, path, config string) []byte {
+	t.Helper()
+
+	reader, err := strategy.Download(path, config)
+	if err != nil {
+		t.Fatalf("download %s: %v", path, err)
+	}
+	return readAll(t, reader)
+}
+
+func readAll(t *testing.T, reader io.ReadCloser) []byte {
+	t.Helper()
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
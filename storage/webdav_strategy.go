@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JAreyes98/healthconnect-storage-service/internal/crypto"
+)
+
+// WebDAVConfig points at the server's DAV root (for Nextcloud that is
+// .../remote.php/dav/files/<user>). Either basic credentials or a bearer token
+// may be used.
+type WebDAVConfig struct {
+	BaseURL        string `json:"base_url"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	BearerToken    string `json:"bearer_token"`
+	RootPath       string `json:"path"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+type WebDAVStrategy struct{}
+
+type webdavClient struct {
+	cfg  WebDAVConfig
+	base *url.URL
+	http *http.Client
+}
+
+func newWebDAVClient(configJSON string) (*webdavClient, error) {
+	var cfg WebDAVConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, fmt.Errorf("webdav config error: %v", err)
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("webdav config error: invalid base_url %q", cfg.BaseURL)
+	}
+
+	timeout := 5 * time.Minute
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	return &webdavClient{cfg: cfg, base: base, http: &http.Client{Timeout: timeout}}, nil
+}
+
+func (c *webdavClient) objectPath(filePath string) string {
+	name := strings.TrimPrefix(filePath, "/")
+	root := strings.Trim(c.cfg.RootPath, "/")
+	if root != "" && name != root && !strings.HasPrefix(name, root+"/") {
+		name = path.Join(root, name)
+	}
+	return name
+}
+
+func (c *webdavClient) url(objectPath string) string {
+	u := *c.base
+	u.Path = u.Path + "/" + strings.TrimPrefix(objectPath, "/")
+	return u.String()
+}
+
+func (c *webdavClient) do(method, objectPath string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.url(objectPath), body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return c.http.Do(req)
+}
+
+// mkcolAll creates every missing collection on the way to dir. Servers answer
+// 405 for collections that already exist.
+func (c *webdavClient) mkcolAll(dir string) error {
+	if dir == "" || dir == "." {
+		return nil
+	}
+
+	current := ""
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" {
+			continue
+		}
+		current = path.Join(current, segment)
+
+		resp, err := c.do("MKCOL", current+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("MKCOL %s returned %s", current, resp.Status)
+		}
+	}
+	return nil
+}
+
+func (s *WebDAVStrategy) Upload(src io.Reader, filename string, configJSON string, shouldEncrypt bool) (string, error) {
+	client, err := newWebDAVClient(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	if shouldEncrypt {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return "", fmt.Errorf("read stream error: %v", err)
+		}
+		data, err = crypto.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("encryption error: %v", err)
+		}
+		src = bytes.NewReader(data)
+	}
+
+	objectPath := client.objectPath(filename)
+	if err := client.mkcolAll(path.Dir(objectPath)); err != nil {
+		return "", fmt.Errorf("webdav mkcol error: %v", err)
+	}
+
+	resp, err := client.do(http.MethodPut, objectPath, src, map[string]string{"Content-Type": "application/octet-stream"})
+	if err != nil {
+		return "", fmt.Errorf("webdav upload error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webdav upload error: PUT returned %s", resp.Status)
+	}
+
+	return objectPath, nil
+}
+
+func (s *WebDAVStrategy) Download(filePath string, configJSON string) (io.ReadCloser, error) {
+	return s.DownloadRange(filePath, configJSON, 0, 0)
+}
+
+func (s *WebDAVStrategy) DownloadRange(filePath string, configJSON string, offset, length int64) (io.ReadCloser, error) {
+	client, err := newWebDAVClient(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	if offset > 0 || length > 0 {
+		rng := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+		if length > 0 {
+			rng += strconv.FormatInt(offset+length-1, 10)
+		}
+		headers["Range"] = rng
+	}
+
+	resp, err := client.do(http.MethodGet, client.objectPath(filePath), nil, headers)
+	if err != nil {
+		return nil, fmt.Errorf("webdav download error: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK && len(headers) == 0:
+		return resp.Body, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("webdav download error: GET returned %s", resp.Status)
+	}
+}
+
+func (s *WebDAVStrategy) Delete(filePath string, configJSON string) error {
+	client, err := newWebDAVClient(configJSON)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.do(http.MethodDelete, client.objectPath(filePath), nil, nil)
+	if err != nil {
+		return fmt.Errorf("webdav delete error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("webdav delete error: DELETE returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ContentLength string `xml:"getcontentlength"`
+				ContentType   string `xml:"getcontenttype"`
+				LastModified  string `xml:"getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const davPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getcontenttype/><d:getlastmodified/></d:prop></d:propfind>`
+
+// List walks collections with Depth: 1 PROPFIND requests, since many servers
+// disable Depth: infinity.
+func (s *WebDAVStrategy) List(prefix string, configJSON string) ([]ObjectInfo, error) {
+	client, err := newWebDAVClient(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	pending := []string{client.objectPath(prefix)}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		resp, err := client.do("PROPFIND", dir, strings.NewReader(davPropfindBody), map[string]string{
+			"Depth":        "1",
+			"Content-Type": "application/xml",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("webdav list error: %v", err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusMultiStatus {
+			resp.Body.Close()
+			return nil, fmt.Errorf("webdav list error: PROPFIND returned %s", resp.Status)
+		}
+
+		var ms davMultistatus
+		err = xml.NewDecoder(resp.Body).Decode(&ms)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("webdav list error: %v", err)
+		}
+
+		for _, r := range ms.Responses {
+			objectPath, err := client.relativeHref(r.Href)
+			if err != nil {
+				return nil, fmt.Errorf("webdav list error: %v", err)
+			}
+			if strings.Trim(objectPath, "/") == strings.Trim(dir, "/") {
+				continue
+			}
+
+			for _, ps := range r.Propstat {
+				if !strings.Contains(ps.Status, " 200 ") {
+					continue
+				}
+				if ps.Prop.ResourceType.Collection != nil {
+					pending = append(pending, objectPath)
+					break
+				}
+
+				size, _ := strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+				modTime, _ := http.ParseTime(ps.Prop.LastModified)
+				objects = append(objects, ObjectInfo{
+					Path:        objectPath,
+					Size:        size,
+					ContentType: ps.Prop.ContentType,
+					ModTime:     modTime,
+				})
+				break
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// relativeHref converts a PROPFIND href (absolute URL or absolute path) into a
+// path relative to the configured base URL.
+func (c *webdavClient) relativeHref(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	rel := strings.TrimPrefix(u.Path, c.base.Path)
+	return strings.Trim(rel, "/"), nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer serves an in-memory DAV tree under /dav that requires basic
+// auth.
+func newWebDAVServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dav := &webdav.Handler{Prefix: "/dav", FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "storage" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebDAVRoundTrip(t *testing.T) {
+	server := newWebDAVServer(t)
+	config := `{"base_url":"` + server.URL + `/dav","username":"storage","password":"secret","path":"records/2024"}`
+
+	roundTrip(t, &WebDAVStrategy{}, config)
+}
+
+func TestWebDAVRejectedCredentials(t *testing.T) {
+	server := newWebDAVServer(t)
+	config := `{"base_url":"` + server.URL + `/dav","username":"storage","password":"wrong"}`
+	s := &WebDAVStrategy{}
+
+	if _, err := s.Upload(bytes.NewReader([]byte("x")), "f.txt", config, false); err == nil {
+		t.Fatal("upload with wrong credentials succeeded")
+	}
+	if _, err := s.Download("f.txt", config); err == nil {
+		t.Fatal("download with wrong credentials succeeded")
+	}
+	if err := s.Delete("f.txt", config); err == nil {
+		t.Fatal("delete with wrong credentials succeeded")
+	}
+}